@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// defaultAccessLogFormat renders an Apache/Nginx "combined"-log-style
+// line: timestamp, status, latency in microseconds, the request line,
+// remote address, and user agent.
+const defaultAccessLogFormat = `{{.Time}} {{.Status}} {{.DurationMicros}}us "{{.Method}} {{.Path}} {{.Proto}}" {{.RemoteAddr}} "{{.UserAgent}}"` + "\n"
+
+// AccessLogEntry is the data available to an AccessLogConfig.Format
+// template for a single completed request.
+type AccessLogEntry struct {
+	Time           string
+	Status         int
+	DurationMicros int64
+	Method         string
+	Path           string
+	Proto          string
+	RemoteAddr     string
+	UserAgent      string
+	BytesWritten   int
+	RequestID      string
+}
+
+var (
+	accessLogFile     *lumberjack.Logger
+	accessLogTemplate *template.Template
+	accessLogConfig   AccessLogConfig
+)
+
+// initAccessLog opens the dedicated access-log file (if enabled) and
+// parses its Format template into a text/template. Call once at
+// startup, before installing AccessLoggingMiddleware; any previously
+// open access log is closed first so it can safely be called again on
+// a config reload.
+func initAccessLog(config AccessLogConfig) error {
+	closeAccessLog()
+	accessLogConfig = config
+	accessLogTemplate = nil
+
+	if !config.Enabled {
+		return nil
+	}
+
+	filePath := config.FilePath
+	if filePath == "" {
+		filePath = "./logs/access.log"
+	}
+
+	maxSize := config.MaxSizeMB
+	if maxSize == 0 {
+		maxSize = 100
+	}
+	maxBackups := config.MaxBackups
+	if maxBackups == 0 {
+		maxBackups = 5
+	}
+	maxAge := config.MaxAgeDays
+	if maxAge == 0 {
+		maxAge = 30
+	}
+
+	accessLogFile = &lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAge,
+		Compress:   config.Compress,
+	}
+
+	format := config.Format
+	if format == "" {
+		format = defaultAccessLogFormat
+	}
+
+	tmpl, err := template.New("access_log").Parse(format)
+	if err != nil {
+		accessLogFile.Close()
+		accessLogFile = nil
+		return fmt.Errorf("invalid access_log format template: %w", err)
+	}
+	accessLogTemplate = tmpl
+
+	return nil
+}
+
+// closeAccessLog closes the access-log file, if one is open. Call from
+// the same shutdown path as CloseLogger.
+func closeAccessLog() error {
+	if accessLogFile == nil {
+		return nil
+	}
+	err := accessLogFile.Close()
+	accessLogFile = nil
+	return err
+}
+
+// disableAccessLog reports whether a completed request should be
+// skipped by AccessLoggingMiddleware, per the configured
+// ExcludePathPrefixes/ExcludeStatuses rules.
+func disableAccessLog(statusCode int, path string) bool {
+	for _, prefix := range accessLogConfig.ExcludePathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, status := range accessLogConfig.ExcludeStatuses {
+		if status == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessLoggingMiddleware writes one line per completed request to the
+// dedicated access log configured via initAccessLog, independent of
+// RequestLoggingMiddleware's application-log lines. It is a no-op when
+// AccessLogConfig.Enabled is false.
+func AccessLoggingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if accessLogFile == nil || accessLogTemplate == nil {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		path := c.Request.URL.Path
+		if disableAccessLog(status, path) {
+			return
+		}
+
+		entry := AccessLogEntry{
+			Time:           start.Format(time.RFC3339),
+			Status:         status,
+			DurationMicros: time.Since(start).Microseconds(),
+			Method:         c.Request.Method,
+			Path:           path,
+			Proto:          c.Request.Proto,
+			RemoteAddr:     c.ClientIP(),
+			UserAgent:      c.Request.UserAgent(),
+			BytesWritten:   c.Writer.Size(),
+			RequestID:      GetRequestID(c),
+		}
+
+		if err := accessLogTemplate.Execute(accessLogFile, entry); err != nil {
+			GetLogger().Error("Failed to write access log entry", "error", err)
+		}
+	}
+}
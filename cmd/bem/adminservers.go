@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest"
+)
+
+// handleAdminAddServerEndpoint adds a BigFix server at runtime: POST
+// /admin/servers with a BigFixServer JSON body. The credentials are
+// validated with a live probe request before anything is persisted; a
+// server that fails the probe is rolled back out of the cache and the
+// config file is left untouched.
+func handleAdminAddServerEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
+	var server BigFixServer
+	if err := c.ShouldBindJSON(&server); err != nil {
+		c.JSON(400, gin.H{
+			"error":      "Invalid request body, expected a BigFixServer object",
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	if server.URL == "" || server.PoolSize <= 0 {
+		c.JSON(400, gin.H{
+			"error":      "url and a positive poolsize are required",
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	baseURL := bfrest.NormalizeServerURL(server.URL)
+	for _, existing := range appConfig.BigFixServers {
+		if bfrest.NormalizeServerURL(existing.URL) == baseURL {
+			c.JSON(409, gin.H{
+				"error":      "server already configured",
+				"url":        baseURL,
+				"request_id": GetRequestID(c),
+			})
+			return
+		}
+	}
+
+	if err := addServerToCache(cache, server, backendConfigFrom(*appConfig)); err != nil {
+		c.JSON(400, gin.H{
+			"error":      fmt.Sprintf("failed to add server: %v", err),
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	// Probe the credentials/connectivity before committing this server
+	// to the config file, the same readiness check used by -check mode.
+	if err := cache.PopulateCoreTypes(server.URL, server.MaxAge); err != nil {
+		cache.RemoveServer(server.URL)
+		c.JSON(502, gin.H{
+			"error":      fmt.Sprintf("probe request failed, server not added: %v", err),
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	appConfig.BigFixServers = append(appConfig.BigFixServers, server)
+	if err := saveConfigLocked(); err != nil {
+		cache.RemoveServer(server.URL)
+		appConfig.BigFixServers = appConfig.BigFixServers[:len(appConfig.BigFixServers)-1]
+		c.JSON(500, gin.H{
+			"error":      fmt.Sprintf("failed to persist config: %v", err),
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	slog.Info("BigFix server added at runtime", "url", baseURL, "request_id", GetRequestID(c))
+	c.JSON(200, gin.H{"success": true, "url": baseURL})
+}
+
+// handleAdminRemoveServerEndpoint removes a BigFix server at runtime:
+// DELETE /admin/servers/:url. The pool is drained and the server's
+// CacheMap flushed before it is dropped from the config file.
+func handleAdminRemoveServerEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
+	rawURL := c.Param("url")
+	decoded, err := url.PathUnescape(rawURL)
+	if err != nil {
+		decoded = rawURL
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	baseURL := bfrest.NormalizeServerURL(decoded)
+	if err := cache.RemoveServer(decoded); err != nil {
+		c.JSON(404, gin.H{
+			"error":      err.Error(),
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	remaining := appConfig.BigFixServers[:0]
+	for _, existing := range appConfig.BigFixServers {
+		if bfrest.NormalizeServerURL(existing.URL) != baseURL {
+			remaining = append(remaining, existing)
+		}
+	}
+	appConfig.BigFixServers = remaining
+
+	if err := saveConfigLocked(); err != nil {
+		c.JSON(500, gin.H{
+			"error":      fmt.Sprintf("server removed from cache but failed to persist config: %v", err),
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	slog.Info("BigFix server removed at runtime", "url", baseURL, "request_id", GetRequestID(c))
+	c.JSON(200, gin.H{"success": true, "url": baseURL})
+}
+
+// handleAdminRevokeClientEndpoint revokes a registered client at
+// runtime: DELETE /admin/clients/:name. The client's record is kept
+// (with Revoked set) rather than deleted, so registration history and
+// any issued-certificate audit trail referencing it survive.
+func handleAdminRevokeClientEndpoint(c *gin.Context) {
+	clientName := c.Param("name")
+
+	if err := store.RevokeClient(clientName); err != nil {
+		c.JSON(500, gin.H{
+			"error":      fmt.Sprintf("failed to revoke client: %v", err),
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+	publishEvent(RegistrationEvent{Type: EventClientRevoked, ClientName: clientName})
+
+	slog.Info("Client revoked via admin endpoint", "client_name", clientName, "request_id", GetRequestID(c))
+	c.JSON(200, gin.H{"success": true, "client_name": clientName})
+}
+
+// saveConfigLocked writes appConfig back to configFilePath via a temp
+// file + rename, the same atomic-write pattern bemstore.FileStore uses
+// for registered_clients.json. Callers must hold configMu.
+func saveConfigLocked() error {
+	data, err := json.MarshalIndent(appConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := configFilePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, configFilePath)
+}
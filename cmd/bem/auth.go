@@ -1,18 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"strings"
 	"time"
-	
+
 	"github.com/gin-gonic/gin"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bemstore"
 )
 
 // Session management functions for cookie-based authentication
@@ -24,157 +28,352 @@ func generateSessionToken() string {
 	return fmt.Sprintf("%x", bytes)
 }
 
+// adminSessionDuration is the default admin session lifetime. An OTP
+// carrying a ValidDuration caps the session so a child session can never
+// outlive the key that minted it.
+const adminSessionDuration = 8 * time.Hour
+
 func createAdminSession(otp RegistrationOTP) string {
 	sessionToken := generateSessionToken()
-	expiresAt := time.Now().Add(8 * time.Hour) // 8-hour working day
-	
-	sessionMutex.Lock()
-	if activeSessions == nil {
-		activeSessions = make(map[string]time.Time)
-	}
-	activeSessions[sessionToken] = expiresAt
-	sessionMutex.Unlock()
-	
+
+	duration := adminSessionDuration
+	if otp.ValidDuration > 0 {
+		if bound := time.Duration(otp.ValidDuration) * time.Second; bound < duration {
+			duration = bound
+		}
+	}
+	expiresAt := time.Now().Add(duration)
+
+	session := bemstore.Session{
+		Token:        sessionToken,
+		ClientName:   otp.ClientName,
+		ExpiresAt:    expiresAt,
+		Capabilities: otp.Capabilities,
+	}
+	if err := store.PutSession(session); err != nil {
+		log.Printf("Error saving admin session for %s: %v", otp.ClientName, err)
+	}
+
 	log.Printf("Created admin session for %s (expires at %s)", otp.ClientName, expiresAt.Format("15:04:05"))
 	return sessionToken
 }
 
 func isValidSession(sessionToken string) bool {
-	sessionMutex.RLock()
-	defer sessionMutex.RUnlock()
-	
-	if activeSessions == nil {
-		return false
+	_, ok := lookupSession(sessionToken)
+	return ok
+}
+
+// lookupSession returns the session record for a token if it exists and
+// has not expired, so handlers can consult its capability set.
+func lookupSession(sessionToken string) (*bemstore.Session, bool) {
+	session, err := store.GetSession(sessionToken)
+	if err != nil {
+		return nil, false
 	}
-	
-	expiresAt, exists := activeSessions[sessionToken]
-	if !exists {
-		return false
+	return &session, true
+}
+
+// defaultOTPTTL is used when Config.OTPTTLHours is 0.
+const defaultOTPTTL = 24 * time.Hour
+
+// otpTTLFromConfig resolves Config.OTPTTLHours into a duration:
+// 0 -> defaultOTPTTL, negative -> 0 (disables OTP sweeping).
+func otpTTLFromConfig(hours int) time.Duration {
+	switch {
+	case hours == 0:
+		return defaultOTPTTL
+	case hours < 0:
+		return 0
+	default:
+		return time.Duration(hours) * time.Hour
 	}
-	
-	// Check if session has expired
-	if time.Now().After(expiresAt) {
-		// Clean up expired session (do this outside the read lock)
-		go func() {
-			sessionMutex.Lock()
-			delete(activeSessions, sessionToken)
-			sessionMutex.Unlock()
-		}()
-		return false
+}
+
+// cleanupExpiredSessions sweeps expired sessions, expired clients, and
+// OTPs older than otpTTL from the registration store, logging the
+// before/after counts so an operator can see the sweep is running.
+func cleanupExpiredSessions(otpTTL time.Duration) {
+	beforeOTPs, _ := store.ListOTPs()
+	beforeClients, _ := store.ListClients()
+
+	if err := store.CleanupExpired(otpTTL); err != nil {
+		log.Printf("Error cleaning up expired sessions: %v", err)
+		return
 	}
-	
-	return true
+
+	afterOTPs, errOTPs := store.ListOTPs()
+	afterClients, errClients := store.ListClients()
+	if errOTPs != nil || errClients != nil {
+		return
+	}
+
+	publishExpiredOTPs(beforeOTPs, afterOTPs)
+	publishExpiredClients(beforeClients, afterClients)
+
+	slog.Info("Registration store cleanup swept expired records",
+		"expired_otps", len(beforeOTPs)-len(afterOTPs),
+		"active_otps", len(afterOTPs),
+		"expired_clients", len(beforeClients)-len(afterClients),
+		"active_clients", len(afterClients))
 }
 
-func cleanupExpiredSessions() {
-	sessionMutex.Lock()
-	defer sessionMutex.Unlock()
-	
-	if activeSessions == nil {
+// publishExpiredOTPs diffs a before/after OTP snapshot pair and
+// publishes an OTPExpired event for each one CleanupExpired removed.
+func publishExpiredOTPs(before, after []bemstore.OTP) {
+	if len(before) == len(after) {
 		return
 	}
-	
-	now := time.Now()
-	for token, expiresAt := range activeSessions {
-		if now.After(expiresAt) {
-			delete(activeSessions, token)
+	remaining := make(map[string]bool, len(after))
+	for _, otp := range after {
+		remaining[otp.ClientName+"\x00"+otp.OneTimeKey] = true
+	}
+	for _, otp := range before {
+		if !remaining[otp.ClientName+"\x00"+otp.OneTimeKey] {
+			publishEvent(RegistrationEvent{Type: EventOTPExpired, ClientName: otp.ClientName, OneTimeKey: otp.OneTimeKey})
+		}
+	}
+}
+
+// publishExpiredClients diffs a before/after client snapshot pair and
+// publishes a ClientExpired event for each one CleanupExpired removed.
+func publishExpiredClients(before, after []bemstore.Client) {
+	if len(before) == len(after) {
+		return
+	}
+	remaining := make(map[string]bool, len(after))
+	for _, client := range after {
+		remaining[client.ClientName] = true
+	}
+	for _, client := range before {
+		if !remaining[client.ClientName] {
+			publishEvent(RegistrationEvent{Type: EventClientExpired, ClientName: client.ClientName})
+		}
+	}
+}
+
+// intersectCapabilities returns the capabilities common to both sets.
+// A nil/empty parent set means "unrestricted", in which case the
+// requested set (if any) is returned as-is. A nil/empty requested set
+// means "no narrowing requested", so the parent set is returned as-is.
+func intersectCapabilities(parent, requested []string) []string {
+	if len(parent) == 0 {
+		return requested
+	}
+	if len(requested) == 0 {
+		return parent
+	}
+
+	allowed := make(map[string]bool, len(parent))
+	for _, c := range parent {
+		allowed[c] = true
+	}
+
+	var result []string
+	for _, c := range requested {
+		if allowed[c] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// hasCapability reports whether caps contains the requested capability.
+// An empty caps slice is treated as unrestricted (legacy keys issued
+// before capability scoping existed).
+func hasCapability(caps []string, required string) bool {
+	if len(caps) == 0 {
+		return true
+	}
+	for _, c := range caps {
+		if c == required {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerCertificateCN returns the Common Name of the client certificate
+// presented on c's TLS connection, if any. It is used during
+// registration to cross-check the claimed ClientName against an mTLS
+// client certificate when MTLSClientCAPath is configured.
+func PeerCertificateCN(c *gin.Context) (string, bool) {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		return "", false
+	}
+	return c.Request.TLS.PeerCertificates[0].Subject.CommonName, true
+}
+
+// ipAllowed reports whether remoteIP falls within one of the given
+// CIDRs. An empty cidrs list means "no restriction".
+func ipAllowed(remoteIP string, cidrs []string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Printf("Invalid AllowedCIDRs entry %q: %v", cidr, err)
+			continue
+		}
+		if ipNet.Contains(ip) {
+			return true
 		}
 	}
+	return false
 }
 
 // Client key validation functions
 
-func isValidClientKey(encodedPrivateKey string) (string, bool) {
+// authClockSkew returns the configured tolerance for JWS iat/exp clock
+// drift, defaulting to 60 seconds when unset.
+func authClockSkew() time.Duration {
+	if appConfig != nil && appConfig.AuthClockSkewSeconds > 0 {
+		return time.Duration(appConfig.AuthClockSkewSeconds) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// isValidClientKey implements the deprecated "Authorization: Client
+// <base64 PKCS1 private key>" scheme, in which the client's own private
+// key is sent on every request. It is only reachable when
+// Config.DeprecatedPrivateKeyAuth is set; new clients authenticate via
+// verifyJWS instead.
+func isValidClientKey(encodedPrivateKey string) (string, []string, bool) {
 	// Decode base64 private key
 	privateKeyBytes, err := base64.StdEncoding.DecodeString(encodedPrivateKey)
 	if err != nil {
 		log.Printf("Failed to decode client key: %v", err)
-		return "", false
+		return "", nil, false
 	}
-	
+
 	// Parse PEM-encoded private key
 	block, _ := pem.Decode(privateKeyBytes)
 	if block == nil {
 		log.Printf("Failed to parse PEM block from client key")
-		return "", false
+		return "", nil, false
 	}
-	
+
 	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
 		log.Printf("Failed to parse RSA private key: %v", err)
-		return "", false
+		return "", nil, false
 	}
-	
+
 	// Derive public key from private key
 	publicKey := &privateKey.PublicKey
 	publicKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
 	if err != nil {
 		log.Printf("Failed to marshal public key: %v", err)
-		return "", false
+		return "", nil, false
 	}
-	
+
 	publicKeyPEM := &pem.Block{
 		Type:  "PUBLIC KEY",
 		Bytes: publicKeyBytes,
 	}
 	publicKeyString := string(pem.EncodeToMemory(publicKeyPEM))
-	
+
 	// Check if this public key matches any registered client
-	registrationMutex.RLock()
-	defer registrationMutex.RUnlock()
-	
-	for _, client := range registeredClients {
-		if client.PublicKey == publicKeyString {
-			// Check if expired
-			if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
-				log.Printf("Client %s key has expired", client.ClientName)
-				return "", false
-			}
-			
-			// Update last used time
-			go func(clientName string) {
-				registrationMutex.Lock()
-				defer registrationMutex.Unlock()
-				for i := range registeredClients {
-					if registeredClients[i].ClientName == clientName {
-						registeredClients[i].LastUsed = time.Now()
-						break
-					}
-				}
-				saveRegisteredClients() // Update persistent storage
-			}(client.ClientName)
-			
-			return client.ClientName, true
-		}
+	client, err := store.GetClientByPublicKey(publicKeyString)
+	if err != nil {
+		log.Printf("No matching registered client found for provided key")
+		return "", nil, false
 	}
-	
-	log.Printf("No matching registered client found for provided key")
-	return "", false
+
+	// Check if expired
+	if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
+		log.Printf("Client %s key has expired", client.ClientName)
+		return "", nil, false
+	}
+
+	// Check if revoked
+	if client.Revoked {
+		log.Printf("Client %s has been revoked", client.ClientName)
+		return "", nil, false
+	}
+
+	// Update last used time
+	go func(clientName string) {
+		if err := store.TouchClient(clientName, time.Now()); err != nil {
+			log.Printf("Error updating last-used time for %s: %v", clientName, err)
+		}
+	}(client.ClientName)
+
+	return client.ClientName, client.Capabilities, true
 }
 
 func isAuthenticatedRequest(c *gin.Context) bool {
 	// Check for valid session cookie (admin access)
 	cookie, err := c.Cookie("bem_session")
-	if err == nil && isValidSession(cookie) {
-		return true
+	if err == nil {
+		if session, ok := lookupSession(cookie); ok {
+			c.Set("client_name", session.ClientName)
+			c.Set("capabilities", session.Capabilities)
+			return true
+		}
 	}
-	
-	// Check for client key authentication via Authorization header
+
 	authHeader := c.GetHeader("Authorization")
-	if strings.HasPrefix(authHeader, "Client ") {
+
+	// JWS bearer token authentication (see verifyJWS).
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+
+		body, err := c.GetRawData()
+		if err != nil {
+			log.Printf("JWS auth: failed to read request body: %v", err)
+			return false
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		clientName, caps, valid := verifyJWS(token, c.Request.Method, c.Request.URL.Path, body, authClockSkew())
+		if valid {
+			c.Set("client_name", clientName)
+			c.Set("capabilities", caps)
+			return true
+		}
+		log.Printf("Invalid JWS bearer token authentication attempt")
+		return false
+	}
+
+	// Deprecated client-key authentication, kept behind a config flag
+	// for clients that haven't migrated to JWS bearer tokens yet.
+	if appConfig != nil && appConfig.DeprecatedPrivateKeyAuth && strings.HasPrefix(authHeader, "Client ") {
 		clientKey := strings.TrimPrefix(authHeader, "Client ")
-		clientName, valid := isValidClientKey(clientKey)
+		clientName, caps, valid := isValidClientKey(clientKey)
 		if valid {
-			// Store client name in context for logging/debugging
 			c.Set("client_name", clientName)
+			c.Set("capabilities", caps)
 			return true
 		}
 		log.Printf("Invalid client key authentication attempt")
 	}
-	
+
 	return false
 }
 
+// requireCapability checks that the authenticated request's session or
+// client key carries the given capability. Call requireAuth first.
+func requireCapability(c *gin.Context, capability string) bool {
+	caps, _ := c.Get("capabilities")
+	capsSlice, _ := caps.([]string)
+	if !hasCapability(capsSlice, capability) {
+		c.JSON(403, gin.H{
+			"error":      "Insufficient capability",
+			"capability": capability,
+			"request_id": GetRequestID(c),
+		})
+		return false
+	}
+	return true
+}
+
 // Authentication middleware helper
 func requireAuth(c *gin.Context) bool {
 	if !isAuthenticatedRequest(c) {
@@ -182,15 +381,17 @@ func requireAuth(c *gin.Context) bool {
 		authHeader := c.GetHeader("Authorization")
 		if strings.HasPrefix(authHeader, "Client ") {
 			c.JSON(401, gin.H{
-				"error":   "Client authentication failed. Key may be expired or invalid.",
-				"expired": true, // Signal to Android app to discard and re-register
+				"error":      "Client authentication failed. Key may be expired or invalid.",
+				"expired":    true, // Signal to Android app to discard and re-register
+				"request_id": GetRequestID(c),
 			})
 		} else {
 			c.JSON(401, gin.H{
-				"error": "Authentication required. Please visit /otp?OneTimeKey=<key> or register your client.",
+				"error":      "Authentication required. Please visit /otp?OneTimeKey=<key> or register your client.",
+				"request_id": GetRequestID(c),
 			})
 		}
 		return false
 	}
 	return true
-}
\ No newline at end of file
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Client certificate issuance: an alternate enrollment path where the
+// client generates and keeps its own private key, presents a PKCS#10
+// CSR to /register, and the server signs it against a CA instead of
+// minting and transmitting a key pair itself (see
+// generateAndRegisterClient for the flow this is an alternative to).
+
+const (
+	// clientCASubjectCN names the bootstrap self-signed CA used when
+	// Config.ClientCA points at files that don't exist yet. An operator
+	// who wants their own CA should supply CertPath/KeyPath before first
+	// run instead of relying on the bootstrap.
+	clientCASubjectCN = "BigFix Mobile Enterprise Client CA"
+
+	// clientCertNeverExpires stands in for an OTP's KeyLifespanDays of 0
+	// ("never expires"): X.509 requires a concrete NotAfter, so a
+	// certificate issued from such an OTP gets a 100 year validity
+	// window instead of an unbounded one. RegisteredClient.ExpiresAt is
+	// still left nil in that case, matching generateAndRegisterClient.
+	clientCertNeverExpires = 100 * 365 * 24 * time.Hour
+)
+
+// clientCACert and clientCAKey are the loaded (or bootstrapped) client
+// enrollment CA, set once by initClientCA at startup. Both remain nil
+// when Config.ClientCA is unset, which disables the CSR flow entirely.
+var (
+	clientCACert *x509.Certificate
+	clientCAKey  crypto.Signer
+)
+
+// initClientCA loads the client enrollment CA from cfg.CertPath/KeyPath,
+// bootstrapping a new self-signed CA (and writing it to those paths)
+// when neither file exists yet. Leaving both paths empty disables
+// CSR-based registration; /register only ever generates raw key pairs.
+func initClientCA(cfg ClientCAConfig) error {
+	if cfg.CertPath == "" && cfg.KeyPath == "" {
+		slog.Info("No client_ca configured, CSR-based registration is disabled")
+		return nil
+	}
+
+	certPEM, certErr := os.ReadFile(cfg.CertPath)
+	keyPEM, keyErr := os.ReadFile(cfg.KeyPath)
+	switch {
+	case certErr == nil && keyErr == nil:
+		cert, key, err := parseClientCA(certPEM, keyPEM)
+		if err != nil {
+			return fmt.Errorf("failed to load client CA: %w", err)
+		}
+		clientCACert, clientCAKey = cert, key
+		slog.Info("Loaded client enrollment CA", "subject", cert.Subject.CommonName, "not_after", cert.NotAfter)
+		return nil
+
+	case os.IsNotExist(certErr) && os.IsNotExist(keyErr):
+		slog.Warn("No client CA found on disk, bootstrapping a self-signed one",
+			"cert_path", cfg.CertPath, "key_path", cfg.KeyPath)
+		return bootstrapAndSaveClientCA(cfg)
+
+	default:
+		return fmt.Errorf("failed to read client CA files: cert=%v key=%v", certErr, keyErr)
+	}
+}
+
+// parseClientCA decodes a PEM-encoded CA certificate and private key
+// pair loaded from disk.
+func parseClientCA(certPEM, keyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("no PEM block found in CA certificate file")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("no PEM block found in CA private key file")
+	}
+	key, err := parseAnyPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("CA private key does not support signing")
+	}
+	return cert, signer, nil
+}
+
+// parseAnyPrivateKey tries each DER private key encoding Go's x509
+// package supports, since the CA key file may have been generated by
+// this code (PKCS1) or hand-provided by an operator (PKCS8/SEC1).
+func parseAnyPrivateKey(der []byte) (any, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unrecognized private key encoding")
+}
+
+// bootstrapAndSaveClientCA generates a new self-signed client enrollment
+// CA and writes it to cfg.CertPath/KeyPath before installing it as the
+// active CA.
+func bootstrapAndSaveClientCA(cfg ClientCAConfig) error {
+	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("failed to generate CA serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: clientCASubjectCN},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(clientCertNeverExpires),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to self-sign CA certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return fmt.Errorf("failed to parse freshly minted CA certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.CertPath), 0700); err != nil {
+		return fmt.Errorf("failed to create client CA directory: %w", err)
+	}
+	certOut := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	if err := os.WriteFile(cfg.CertPath, certOut, 0644); err != nil {
+		return fmt.Errorf("failed to write client CA certificate: %w", err)
+	}
+	keyOut := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(cfg.KeyPath, keyOut, 0600); err != nil {
+		return fmt.Errorf("failed to write client CA private key: %w", err)
+	}
+
+	clientCACert, clientCAKey = cert, key
+	slog.Info("Bootstrapped self-signed client enrollment CA",
+		"cert_path", cfg.CertPath, "key_path", cfg.KeyPath, "not_after", cert.NotAfter)
+	return nil
+}
+
+// issueCertificateForClient signs a client-supplied PKCS#10 CSR against
+// the configured client CA, stamping the resulting certificate's
+// NotAfter from otp.KeyLifespanDays and its subject CommonName from
+// otp.ClientName. The client already holds the matching private key, so
+// RegisterResponse.PrivateKey is left empty; CertificatePEM carries the
+// signed certificate instead.
+func issueCertificateForClient(otp RegistrationOTP, csrPEM string, requestedCapabilities []string) (*RegisterResponse, error) {
+	if clientCACert == nil || clientCAKey == nil {
+		return nil, fmt.Errorf("CSR-based registration is disabled: no client_ca configured")
+	}
+
+	block, _ := pem.Decode([]byte(csrPEM))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, fmt.Errorf("csr must be a PEM-encoded CERTIFICATE REQUEST")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("CSR signature does not verify: %w", err)
+	}
+
+	validity := clientCertNeverExpires
+	var expiresAt *time.Time
+	if otp.KeyLifespanDays > 0 {
+		validity = time.Duration(otp.KeyLifespanDays) * 24 * time.Hour
+	}
+
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if otp.KeyLifespanDays > 0 {
+		expiresAt = &notAfter
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: otp.ClientName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, clientCACert, csr.PublicKey, clientCAKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign client certificate: %w", err)
+	}
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
+
+	fingerprint := sha256.Sum256(certDER)
+	fingerprintHex := hex.EncodeToString(fingerprint[:])
+
+	pubKeyPEM, err := publicKeyToPEM(csr.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode client public key: %w", err)
+	}
+
+	client := RegisteredClient{
+		ClientName:             otp.ClientName,
+		PublicKey:              pubKeyPEM,
+		RegisteredAt:           now,
+		ExpiresAt:              expiresAt,
+		LastUsed:               now,
+		KeyLifespanDays:        otp.KeyLifespanDays,
+		Capabilities:           intersectCapabilities(otp.Capabilities, requestedCapabilities),
+		CertificatePEM:         certPEM,
+		CertificateFingerprint: fingerprintHex,
+	}
+
+	if err := store.PutClient(clientToStore(client)); err != nil {
+		return nil, fmt.Errorf("failed to save registered client: %v", err)
+	}
+
+	slog.Info("Issued client certificate",
+		"client_name", otp.ClientName,
+		"serial", serial.String(),
+		"fingerprint", fingerprintHex,
+		"not_after", notAfter)
+
+	return &RegisterResponse{
+		Success:        true,
+		CertificatePEM: certPEM,
+		Message:        "Client certificate issued successfully",
+	}, nil
+}
+
+// publicKeyToPEM PKIX-encodes a public key the same way
+// generateClientKeyPair does for server-generated key pairs, so
+// CSR-issued clients round-trip through RegisteredClient.PublicKey (and
+// verifyJWS) identically to clients enrolled the legacy way.
+func publicKeyToPEM(pub any) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest"
+)
+
+// Exit codes for -check mode, distinct from the default os.Exit(1) used
+// elsewhere in main for startup/config failures.
+const (
+	checkExitOK        = 0
+	checkExitConnError = 2 // a server couldn't even be configured, retrying won't help
+	checkExitTimeout   = 3 // retry-timeout elapsed before every server became ready
+)
+
+// runCheckMode is a non-interactive readiness probe: it connects to
+// every configured BigFix server and repeatedly calls PopulateCoreTypes
+// until all of them succeed and the cache holds at least one entry, or
+// retryTimeout elapses. It never starts the HTTP(S) listener, the
+// registration watcher, or the interactive CLI - it is meant to be run
+// as `bem -c bem.json -check` from a container's readiness probe.
+func runCheckMode(config Config, retryTimeout, retrySleep time.Duration) int {
+	if len(config.BigFixServers) == 0 {
+		slog.Error("check: no bigfix_servers configured")
+		return checkExitConnError
+	}
+
+	cache := bfrest.GetCache(config.AppCacheTimeout, config.MaxCacheLifetime)
+
+	for _, server := range config.BigFixServers {
+		tlsOpts, err := buildServerTLSOptions(server)
+		if err != nil {
+			slog.Error("check: failed to build TLS options", "url", server.URL, "error", err)
+			return checkExitConnError
+		}
+		if _, err := cache.AddServerWithTLS(server.URL, server.Username, server.Password, server.PoolSize, server.MaxAge, tlsOpts); err != nil {
+			slog.Error("check: failed to add server", "url", server.URL, "error", err)
+			return checkExitConnError
+		}
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		allReady := true
+		for _, server := range config.BigFixServers {
+			if err := cache.PopulateCoreTypes(server.URL, server.MaxAge); err != nil {
+				allReady = false
+				slog.Warn("check: server not ready", "url", server.URL, "attempt", attempt, "error", err)
+			}
+		}
+
+		entries := cache.Stats().HotEntries
+		elapsed := time.Since(start)
+		fmt.Printf("check: attempt %d, elapsed %s / timeout %s, cache entries: %d\n",
+			attempt, elapsed.Round(time.Second), retryTimeout, entries)
+
+		if allReady && entries > 0 {
+			fmt.Println("check: all BigFix servers reachable, cache populated")
+			return checkExitOK
+		}
+
+		if elapsed >= retryTimeout {
+			slog.Error("check: retry-timeout elapsed before all servers became ready", "elapsed", elapsed)
+			return checkExitTimeout
+		}
+
+		time.Sleep(retrySleep)
+	}
+}
@@ -4,41 +4,51 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http/pprof"
 	neturl "net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest"
 )
 
 // HTTP endpoint handlers
 
 func setupRoutes(r *gin.Engine, cache *bfrest.BigFixCache, config Config) {
+	SetReadOnly(config.ReadOnly)
+
+	// Chain run for every request: correlation ID, config lookup,
+	// auth resolution, then the read-only gate.
+	r.Use(RequestIDMiddleware())
+	r.Use(MetricsMiddleware())
+	r.Use(ConfigMiddleware(config))
+	r.Use(AuthMiddleware())
+	r.Use(ReadOnlyMiddleware())
+
+	// Health check - always reachable, even in read-only mode
+	r.GET("/healthz", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
 	// OTP endpoint for admin session creation (no authentication required)
 	r.GET("/otp", handleOTPEndpoint)
 	r.POST("/otp", handleOTPEndpoint)
 
 	// Client registration endpoint (no authentication required)
-	r.POST("/register", func(c *gin.Context) {
-		handleRegisterEndpoint(c, config)
-	})
-	r.GET("/register", func(c *gin.Context) {
-		handleRegisterEndpoint(c, config)
-	})
+	r.POST("/register", handleRegisterEndpoint)
+	r.GET("/register", handleRegisterEndpoint)
 
 	// Registration request endpoint (no authentication required)
-	r.GET("/requestregistration", func(c *gin.Context) {
-		handleRegistrationRequest(c, config)
-	})
-	r.POST("/requestregistration", func(c *gin.Context) {
-		handleRegistrationRequest(c, config)
-	})
+	r.GET("/requestregistration", handleRegistrationRequest)
+	r.POST("/requestregistration", handleRegistrationRequest)
 
 	// Help endpoint (no authentication required)
 	r.GET("/help", handleHelpEndpoint)
 	r.POST("/help", handleHelpEndpoint)
-	
+
 	// Debug endpoint - temporary, no auth required
 	r.GET("/debug/servers", func(c *gin.Context) {
 		handleDebugServersEndpoint(c, cache)
@@ -47,34 +57,102 @@ func setupRoutes(r *gin.Engine, cache *bfrest.BigFixCache, config Config) {
 		handleDebugServersEndpoint(c, cache)
 	})
 
-	// Protected endpoints require authentication
-	r.GET("/urls", func(c *gin.Context) {
+	// Live dump of CacheMap contents, for debugging the adaptive MaxAge
+	// extension. Same no-auth posture as the other /debug endpoints.
+	r.GET("/debug/cache", func(c *gin.Context) {
+		handleDebugCacheEndpoint(c, cache)
+	})
+
+	// Prometheus scrape endpoint for the cache/pool metrics recorded by
+	// pkg/bfrest/metrics plus BEM's own registration/session gauges and
+	// per-route request latency.
+	r.GET("/metrics", func(c *gin.Context) {
+		refreshRegistrationGauges()
+		promhttp.Handler().ServeHTTP(c.Writer, c.Request)
+	})
+
+	// Standard net/http/pprof profiles, for live CPU/heap/goroutine
+	// introspection of the cache subsystem. Same no-auth posture as the
+	// other /debug routes - not for production exposure without a
+	// reverse-proxy ACL in front of it.
+	pprofGroup := r.Group("/debug/pprof")
+	{
+		pprofGroup.GET("/", gin.WrapF(pprof.Index))
+		pprofGroup.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+		pprofGroup.GET("/profile", gin.WrapF(pprof.Profile))
+		pprofGroup.GET("/symbol", gin.WrapF(pprof.Symbol))
+		pprofGroup.POST("/symbol", gin.WrapF(pprof.Symbol))
+		pprofGroup.GET("/trace", gin.WrapF(pprof.Trace))
+		pprofGroup.GET("/allocs", gin.WrapH(pprof.Handler("allocs")))
+		pprofGroup.GET("/block", gin.WrapH(pprof.Handler("block")))
+		pprofGroup.GET("/goroutine", gin.WrapH(pprof.Handler("goroutine")))
+		pprofGroup.GET("/heap", gin.WrapH(pprof.Handler("heap")))
+		pprofGroup.GET("/mutex", gin.WrapH(pprof.Handler("mutex")))
+		pprofGroup.GET("/threadcreate", gin.WrapH(pprof.Handler("threadcreate")))
+	}
+
+	// Protected endpoints require the query:read capability
+	r.GET("/urls", RequireCap("query:read"), func(c *gin.Context) {
 		handleURLsEndpoint(c, cache)
 	})
-	r.POST("/urls", func(c *gin.Context) {
+	r.POST("/urls", RequireCap("query:read"), func(c *gin.Context) {
 		handleURLsEndpoint(c, cache)
 	})
 
-	r.GET("/servers", func(c *gin.Context) {
+	r.GET("/servers", RequireCap("query:read"), func(c *gin.Context) {
 		handleServersEndpoint(c, cache)
 	})
-	r.POST("/servers", func(c *gin.Context) {
+	r.POST("/servers", RequireCap("query:read"), func(c *gin.Context) {
 		handleServersEndpoint(c, cache)
 	})
 
-	r.GET("/summary", func(c *gin.Context) {
+	r.GET("/summary", RequireCap("query:read"), func(c *gin.Context) {
 		handleSummaryEndpoint(c, cache)
 	})
-	r.POST("/summary", func(c *gin.Context) {
+	r.POST("/summary", RequireCap("query:read"), func(c *gin.Context) {
 		handleSummaryEndpoint(c, cache)
 	})
 
-	r.GET("/cache", func(c *gin.Context) {
+	r.GET("/cache", RequireCap("query:read"), func(c *gin.Context) {
 		handleCacheEndpoint(c, cache)
 	})
-	r.POST("/cache", func(c *gin.Context) {
+	r.POST("/cache", RequireCap("query:read"), func(c *gin.Context) {
 		handleCacheEndpoint(c, cache)
 	})
+
+	// Streaming query results over a WebSocket, same capability as the
+	// buffered /urls endpoint.
+	r.GET("/ws/query", RequireCap("query:read"), func(c *gin.Context) {
+		handleWSQueryEndpoint(c, cache)
+	})
+
+	// Streams cache mutation events (created/refreshed/unchanged/expired)
+	// over a WebSocket, filterable by server URL prefix or URL glob.
+	// Auth is the bem_session cookie, checked directly via requireAuth
+	// since this is an admin observability surface rather than a
+	// capability-scoped client route.
+	r.GET("/watch", func(c *gin.Context) {
+		handleWatchEndpoint(c, cache)
+	})
+
+	// Runtime log-level control, for cranking up verbosity during an
+	// incident without a redeploy.
+	r.GET("/admin/log-level", RequireCap("admin:loglevel"), handleGetLogLevelEndpoint)
+	r.POST("/admin/log-level", RequireCap("admin:loglevel"), handleSetLogLevelEndpoint)
+
+	// Runtime BigFix server management, so an operator can add or
+	// remove a server without a restart. Mirrors the config file's
+	// bigfix_servers entries and persists changes back to it.
+	r.POST("/admin/servers", RequireCap("admin:servers"), func(c *gin.Context) {
+		handleAdminAddServerEndpoint(c, cache)
+	})
+	r.DELETE("/admin/servers/:url", RequireCap("admin:servers"), func(c *gin.Context) {
+		handleAdminRemoveServerEndpoint(c, cache)
+	})
+
+	// Client revocation, so an operator can disable a compromised or
+	// decommissioned client without deleting its registration history.
+	r.DELETE("/admin/clients/:name", RequireCap("admin:clients"), handleAdminRevokeClientEndpoint)
 }
 
 func handleOTPEndpoint(c *gin.Context) {
@@ -100,13 +178,8 @@ func handleOTPEndpoint(c *gin.Context) {
 
 	// Create admin session and set cookie
 	sessionToken := createAdminSession(*otp)
-	
+
 	c.SetCookie("bem_session", sessionToken, 8*60*60, "/", "", false, true) // 8 hours, HttpOnly
-	
-	// Save updated OTPs (with the used one removed)
-	if err := saveRegistrationOTPs(); err != nil {
-		log.Printf("Error saving registration OTPs after admin session creation: %v", err)
-	}
 
 	log.Printf("Admin session created using OTP for: %s", otp.ClientName)
 	c.JSON(200, gin.H{
@@ -116,7 +189,9 @@ func handleOTPEndpoint(c *gin.Context) {
 	})
 }
 
-func handleRegisterEndpoint(c *gin.Context, config Config) {
+func handleRegisterEndpoint(c *gin.Context) {
+	config := c.MustGet("config").(Config)
+
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, RegisterResponse{
@@ -156,8 +231,45 @@ func handleRegisterEndpoint(c *gin.Context, config Config) {
 		return
 	}
 
-	// Generate key pair and register client
-	response, err := generateAndRegisterClient(*otp, config.KeySize)
+	if otp.NamePrefix != "" && !strings.HasPrefix(req.ClientName, otp.NamePrefix) {
+		log.Printf("Registration rejected: client name %s does not match required prefix %q", req.ClientName, otp.NamePrefix)
+		c.JSON(403, RegisterResponse{
+			Success: false,
+			Message: "ClientName does not match the required prefix for this key",
+		})
+		return
+	}
+
+	if !ipAllowed(c.ClientIP(), otp.AllowedCIDRs) {
+		log.Printf("Registration rejected: remote IP %s not in AllowedCIDRs for %s", c.ClientIP(), req.ClientName)
+		c.JSON(403, RegisterResponse{
+			Success: false,
+			Message: "Remote address is not permitted to use this key",
+		})
+		return
+	}
+
+	// When mTLS is in effect, the client certificate's CN is the presumed
+	// ClientName - a device that presents a cert for one name cannot
+	// register under another.
+	if cn, presented := PeerCertificateCN(c); presented && cn != req.ClientName {
+		log.Printf("Registration rejected: client certificate CN %q does not match ClientName %q", cn, req.ClientName)
+		c.JSON(403, RegisterResponse{
+			Success: false,
+			Message: "ClientName does not match the presented client certificate",
+		})
+		return
+	}
+
+	// Generate key pair and register client, or sign the client's CSR if
+	// it supplied one instead.
+	var response *RegisterResponse
+	var err error
+	if req.CSR != "" {
+		response, err = issueCertificateForClient(*otp, req.CSR, req.RequestedCapabilities)
+	} else {
+		response, err = generateAndRegisterClient(*otp, config.ClientKeyAlgorithm, config.KeySize, req.RequestedCapabilities, vanityKeyTimeoutFromConfig(config.VanityKeyTimeoutSeconds))
+	}
 	if err != nil {
 		log.Printf("Failed to register client %s: %v", req.ClientName, err)
 		c.JSON(500, RegisterResponse{
@@ -173,15 +285,17 @@ func handleRegisterEndpoint(c *gin.Context, config Config) {
 
 func handleHelpEndpoint(c *gin.Context) {
 	endpoints := []string{
+		"/healthz",
 		"/otp",
 		"/requestregistration",
 		"/register",
 		"/help",
 		"--- Protected endpoints (require authentication) ---",
 		"/urls",
-		"/servers", 
+		"/servers",
 		"/summary",
 		"/cache",
+		"/ws/query",
 	}
 	htmlContent := "<html><body><h1>Available Endpoints</h1><ul>"
 	for _, endpoint := range endpoints {
@@ -192,12 +306,8 @@ func handleHelpEndpoint(c *gin.Context) {
 }
 
 func handleURLsEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
-	if !requireAuth(c) {
-		return
-	}
-	
 	var url string
-	
+
 	// Handle both GET and POST methods
 	if c.Request.Method == "POST" {
 		// For POST requests, expect JSON body with url field
@@ -221,7 +331,7 @@ func handleURLsEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 			fmt.Printf("GET /urls - URL from query: %s\n", url)
 		}
 	}
-	
+
 	if url == "" {
 		c.JSON(400, gin.H{
 			"error": "URL parameter is required",
@@ -238,12 +348,10 @@ func handleURLsEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 		baseURL := parsedURL.Scheme + "://" + parsedURL.Host
 		if scValue, ok := cache.ServerCache.Load(baseURL); ok {
 			sc := scValue.(*bfrest.BigFixServerCache)
-			if value, ok := sc.CacheMap.Load(url); ok {
-				if cm, ok := value.(*bfrest.CacheItem); ok {
-					isEmpty := cm.Json == ""
-					isExpired := requestTime-cm.Timestamp > int64(cm.MaxAge)
-					isCacheHit = !isEmpty && !isExpired
-				}
+			if cm, ok := sc.CacheMap.Get(url); ok {
+				isEmpty := cm.Json == ""
+				isExpired := requestTime-cm.Timestamp > int64(cm.MaxAge)
+				isCacheHit = !isEmpty && !isExpired
 			}
 		}
 	}
@@ -262,6 +370,19 @@ func handleURLsEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 	}
 
 	if err == nil {
+		// Emit the content hash as a strong ETag and honor If-None-Match
+		// so a client re-polling an unchanged query gets a 304 with an
+		// empty body instead of re-downloading the same payload;
+		// hitcount/TTL above have already been updated by cache.Get.
+		if cacheItem.ContentHash != "" {
+			etag := `"` + cacheItem.ContentHash + `"`
+			c.Header("ETag", etag)
+			if c.GetHeader("If-None-Match") == etag {
+				c.Status(304)
+				return
+			}
+		}
+
 		// Check if this is a JSON passthrough (from output=json requests)
 		// by looking at the URL to see if it contains output=json
 		var responseData interface{}
@@ -308,28 +429,24 @@ func handleURLsEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 // Debug endpoint to check server cache without authentication
 func handleDebugServersEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 	var serverNames []string
-	
+
 	cache.ServerCache.Range(func(key, value interface{}) bool {
 		server := value.(*bfrest.BigFixServerCache)
 		serverNames = append(serverNames, server.ServerName)
 		return true
 	})
-	
+
 	c.JSON(200, gin.H{
-		"debug": "no-auth-required",
+		"debug":           "no-auth-required",
 		"ServerNames":     serverNames,
 		"NumberOfServers": len(serverNames),
-		"message": "This is a debug endpoint. Remove in production.",
+		"message":         "This is a debug endpoint. Remove in production.",
 	})
 }
 
 func handleServersEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
-	if !requireAuth(c) {
-		return
-	}
-
 	type ServerInfo struct {
-		Name   string  `json:"name"`
+		Name     string  `json:"name"`
 		RAMBytes int64   `json:"ram_bytes"`
 		RAMKB    float64 `json:"ram_kb"`
 		RAMMB    float64 `json:"ram_mb"`
@@ -341,8 +458,7 @@ func handleServersEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 		server := value.(*bfrest.BigFixServerCache)
 		var ramBytes int64
 
-		server.CacheMap.Range(func(key, value interface{}) bool {
-			item := value.(*bfrest.CacheItem)
+		server.CacheMap.Range(func(key string, item *bfrest.CacheItem) bool {
 			ramBytes += int64(len(item.Json))
 			return true
 		})
@@ -357,18 +473,16 @@ func handleServersEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 	})
 
 	c.JSON(200, gin.H{
-		"servers":         servers,
+		"servers":           servers,
 		"number_of_servers": len(servers),
 	})
 }
 
 func handleSummaryEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
-	if !requireAuth(c) {
-		return
-	}
-	
 	summary := make(map[string]interface{})
 	var totalSize int64
+	var totalEvicted uint64
+	var totalSuppressed uint64
 
 	cache.ServerCache.Range(func(key, value interface{}) bool {
 		server := value.(*bfrest.BigFixServerCache)
@@ -376,8 +490,7 @@ func handleSummaryEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 		count, current, expired := 0, 0, 0
 		var serverSize int64
 
-		server.CacheMap.Range(func(key, value interface{}) bool {
-			v := value.(*bfrest.CacheItem)
+		server.CacheMap.Range(func(key string, v *bfrest.CacheItem) bool {
 			count++
 			itemSize := int64(len(v.Json))
 			serverSize += itemSize
@@ -392,11 +505,17 @@ func handleSummaryEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 		serverSummary["total_items"] = count
 		serverSummary["expired_items"] = expired
 		serverSummary["current_items"] = current
+		evicted := atomic.LoadUint64(&server.EvictionCount)
+		serverSummary["evicted_items"] = evicted
+		suppressed := atomic.LoadUint64(&server.RefreshRequests) - atomic.LoadUint64(&server.ActualFetches)
+		serverSummary["stampede_suppressed"] = suppressed
 		serverSummary["ram_bytes"] = serverSize
 		serverSummary["ram_kb"] = float64(serverSize) / 1024.0
 		serverSummary["ram_mb"] = float64(serverSize) / (1024.0 * 1024.0)
 		summary[server.ServerName] = serverSummary
 		totalSize += serverSize
+		totalEvicted += evicted
+		totalSuppressed += suppressed
 
 		return true
 	})
@@ -404,22 +523,20 @@ func handleSummaryEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 	summary["total_ram_bytes"] = totalSize
 	summary["total_ram_kb"] = float64(totalSize) / 1024.0
 	summary["total_ram_mb"] = float64(totalSize) / (1024.0 * 1024.0)
+	summary["evicted_items"] = totalEvicted
+	summary["stampede_suppressed"] = totalSuppressed
 	c.JSON(200, summary)
 }
 
 func handleCacheEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
-	if !requireAuth(c) {
-		return
-	}
-	
 	cacheData := make(map[string][]string)
 
 	cache.ServerCache.Range(func(key, value interface{}) bool {
 		server := value.(*bfrest.BigFixServerCache)
 		var cacheItems []string
 
-		server.CacheMap.Range(func(key, value interface{}) bool {
-			cacheItems = append(cacheItems, key.(string))
+		server.CacheMap.Range(func(key string, _ *bfrest.CacheItem) bool {
+			cacheItems = append(cacheItems, key)
 			return true
 		})
 
@@ -428,4 +545,85 @@ func handleCacheEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
 	})
 
 	c.JSON(200, cacheData)
-}
\ No newline at end of file
+}
+
+// debugCacheItem is one entry in handleDebugCacheEndpoint's dump.
+type debugCacheItem struct {
+	URL         string `json:"url"`
+	AgeSeconds  int64  `json:"age_seconds"`
+	MaxAge      uint64 `json:"max_age"`
+	BaseMaxAge  uint64 `json:"base_max_age"`
+	ContentHash string `json:"content_hash"`
+	Bytes       int    `json:"bytes"`
+}
+
+// handleDebugCacheEndpoint dumps every server's CacheMap contents as JSON
+// for live debugging of the adaptive MaxAge extension - operators can see
+// at a glance whether an entry's age/MaxAge ratio means it's about to
+// refresh, and how big each cached payload actually is.
+func handleDebugCacheEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
+	now := time.Now().Unix()
+	dump := make(map[string][]debugCacheItem)
+
+	cache.ServerCache.Range(func(key, value interface{}) bool {
+		server := value.(*bfrest.BigFixServerCache)
+		var items []debugCacheItem
+
+		server.CacheMap.Range(func(url string, item *bfrest.CacheItem) bool {
+			items = append(items, debugCacheItem{
+				URL:         url,
+				AgeSeconds:  now - item.Timestamp,
+				MaxAge:      item.MaxAge,
+				BaseMaxAge:  item.BaseMaxAge,
+				ContentHash: item.ContentHash,
+				Bytes:       len(item.Json),
+			})
+			return true
+		})
+
+		dump[server.ServerName] = items
+		return true
+	})
+
+	c.JSON(200, dump)
+}
+
+// handleGetLogLevelEndpoint reports the logger's current verbosity
+// threshold.
+func handleGetLogLevelEndpoint(c *gin.Context) {
+	c.JSON(200, gin.H{"level": CurrentLogLevel().String()})
+}
+
+// handleSetLogLevelEndpoint changes the logger's verbosity threshold at
+// runtime, e.g. POST /admin/log-level {"level":"debug"}.
+func handleSetLogLevelEndpoint(c *gin.Context) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{
+			"error":      "Invalid request body, expected {\"level\":\"debug|info|warn|error\"}",
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	level, err := ParseLogLevel(req.Level)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"error":      err.Error(),
+			"request_id": GetRequestID(c),
+		})
+		return
+	}
+
+	previous := CurrentLogLevel()
+	SetLogLevel(level)
+	GetLogger().Warn("Log level changed via admin endpoint",
+		"previous_level", previous.String(),
+		"new_level", level.String(),
+		"request_id", GetRequestID(c),
+	)
+
+	c.JSON(200, gin.H{"level": level.String()})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrorReporter forwards panics and 5xx errors to an external
+// error-tracking or observability backend. Report should not block the
+// request path for long; implementations that talk to a remote
+// collector should do so asynchronously and rely on Flush at shutdown
+// to guarantee delivery.
+type ErrorReporter interface {
+	Report(ctx context.Context, err error, fields map[string]any)
+	Flush(ctx context.Context) error
+}
+
+// errorReporter is the active ErrorReporter, set by InitErrorReporter.
+// It defaults to noopErrorReporter so callers never need a nil check.
+var errorReporter ErrorReporter = noopErrorReporter{}
+
+// InitErrorReporter builds and installs the ErrorReporter selected by
+// config.ErrorReporter.Driver.
+func InitErrorReporter(config ErrorReporterConfig) error {
+	reporter, err := newErrorReporter(config)
+	if err != nil {
+		return err
+	}
+	errorReporter = reporter
+	return nil
+}
+
+// newErrorReporter builds the ErrorReporter driver selected by
+// config.Driver. An empty driver disables reporting.
+func newErrorReporter(config ErrorReporterConfig) (ErrorReporter, error) {
+	switch config.Driver {
+	case "":
+		return noopErrorReporter{}, nil
+
+	case "sentry":
+		if config.SentryDSN == "" {
+			return nil, fmt.Errorf("error_reporter.sentry_dsn must be set when error_reporter.driver is \"sentry\"")
+		}
+		return newSentryReporter(config.SentryDSN)
+
+	case "otlp":
+		if config.OTLPEndpoint == "" {
+			return nil, fmt.Errorf("error_reporter.otlp_endpoint must be set when error_reporter.driver is \"otlp\"")
+		}
+		return newOTLPReporter(config.OTLPEndpoint, config.OTLPInsecure)
+
+	default:
+		return nil, fmt.Errorf("unknown error_reporter.driver %q (want \"\", \"sentry\", or \"otlp\")", config.Driver)
+	}
+}
+
+// noopErrorReporter is used when no error_reporter driver is configured.
+type noopErrorReporter struct{}
+
+func (noopErrorReporter) Report(ctx context.Context, err error, fields map[string]any) {}
+func (noopErrorReporter) Flush(ctx context.Context) error                              { return nil }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// otlpReporter forwards errors as OTLP log records via a batching
+// exporter. provider owns the gRPC connection and background worker;
+// Flush/Shutdown are driven through it at shutdown.
+type otlpReporter struct {
+	provider *sdklog.LoggerProvider
+	logger   otellog.Logger
+}
+
+// newOTLPReporter dials endpoint and starts a batch log exporter. The
+// connection is established lazily by the gRPC client; a bad endpoint
+// only surfaces once records are emitted.
+func newOTLPReporter(endpoint string, insecure bool) (ErrorReporter, error) {
+	opts := []otlploggrpc.Option{otlploggrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlploggrpc.WithInsecure())
+	}
+
+	exporter, err := otlploggrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+	)
+
+	return &otlpReporter{
+		provider: provider,
+		logger:   provider.Logger("github.com/tubalcaine/bigfix-mobile-enterprise"),
+	}, nil
+}
+
+func (r *otlpReporter) Report(ctx context.Context, err error, fields map[string]any) {
+	var record otellog.Record
+	record.SetSeverity(otellog.SeverityError)
+	record.SetBody(otellog.StringValue(err.Error()))
+
+	attrs := make([]otellog.KeyValue, 0, len(fields))
+	for k, v := range fields {
+		attrs = append(attrs, otellog.String(k, fmt.Sprintf("%v", v)))
+	}
+	record.AddAttributes(attrs...)
+
+	r.logger.Emit(ctx, record)
+}
+
+func (r *otlpReporter) Flush(ctx context.Context) error {
+	if err := r.provider.ForceFlush(ctx); err != nil {
+		return err
+	}
+	return r.provider.Shutdown(ctx)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// sentryReporter forwards errors to Sentry via the official Go SDK.
+type sentryReporter struct{}
+
+// newSentryReporter initializes the global Sentry client. sentry-go has
+// no per-instance client handle for our use: sentry.CaptureException
+// always reports through sentry.CurrentHub(), so sentryReporter itself
+// carries no state.
+func newSentryReporter(dsn string) (ErrorReporter, error) {
+	if err := sentry.Init(sentry.ClientOptions{Dsn: dsn}); err != nil {
+		return nil, err
+	}
+	return sentryReporter{}, nil
+}
+
+func (sentryReporter) Report(ctx context.Context, err error, fields map[string]any) {
+	sentry.WithScope(func(scope *sentry.Scope) {
+		for k, v := range fields {
+			scope.SetExtra(k, v)
+		}
+		sentry.CaptureException(err)
+	})
+}
+
+func (sentryReporter) Flush(ctx context.Context) error {
+	timeout := 2 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	sentry.Flush(timeout)
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType names a point in the registration lifecycle that other
+// systems (SIEMs, chat bots, the BigFix console) might want to react
+// to without polling the registration store.
+type EventType string
+
+const (
+	EventOTPCreated       EventType = "otp_created"
+	EventOTPConsumed      EventType = "otp_consumed"
+	EventOTPExpired       EventType = "otp_expired"
+	EventClientRegistered EventType = "client_registered"
+	EventClientExpired    EventType = "client_expired"
+	EventClientRevoked    EventType = "client_revoked"
+)
+
+// RegistrationEvent is published to every subscriber for every
+// lifecycle transition. OneTimeKey is only meaningful for OTP events
+// and is left empty for client events.
+type RegistrationEvent struct {
+	Type       EventType `json:"type"`
+	ClientName string    `json:"client_name"`
+	OneTimeKey string    `json:"one_time_key,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// EventSubscriber receives every published RegistrationEvent. Handle
+// should not block the caller for long; a subscriber that talks to a
+// remote system should log and drop on failure rather than retry
+// inline, the same way ErrorReporter.Report is fire-and-forget.
+type EventSubscriber interface {
+	Handle(event RegistrationEvent)
+}
+
+// eventBus fans a RegistrationEvent out to every registered subscriber,
+// each on its own goroutine so a slow or unreachable subscriber can
+// never delay the registration path that published the event.
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers []EventSubscriber
+}
+
+// events is the process-wide bus; publishEvent is the usual way to
+// reach it. It starts empty, so publishing before any subscriber is
+// registered (or when none are configured) is a no-op.
+var events = &eventBus{}
+
+// subscribe registers sub to receive every future published event.
+func (b *eventBus) subscribe(sub EventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, sub)
+}
+
+// publish fans event out to every subscriber concurrently.
+func (b *eventBus) publish(event RegistrationEvent) {
+	b.mu.RLock()
+	subs := make([]EventSubscriber, len(b.subscribers))
+	copy(subs, b.subscribers)
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		go sub.Handle(event)
+	}
+}
+
+// publishEvent stamps event.Time as now and fans it out to every
+// registered subscriber. Callers only need to fill in Type, ClientName,
+// and (for OTP events) OneTimeKey.
+func publishEvent(event RegistrationEvent) {
+	event.Time = time.Now()
+	events.publish(event)
+}
+
+// initEventSubscribers registers the built-in subscribers selected by
+// config: an HTTP webhook (config.Webhook.URL) and/or an RFC 5424
+// syslog target (config.Syslog.Address). Either, both, or neither may
+// be configured; leaving a subscriber's address empty disables it.
+func initEventSubscribers(config EventSubscribersConfig) error {
+	if config.Webhook.URL != "" {
+		events.subscribe(newWebhookSubscriber(config.Webhook))
+	}
+	if config.Syslog.Address != "" {
+		sub, err := newSyslogEventSubscriber(config.Syslog)
+		if err != nil {
+			return err
+		}
+		events.subscribe(sub)
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWS-signed bearer token authentication.
+//
+// A registered client signs a compact JWS (base64url(header).
+// base64url(payload).base64url(signature)) binding the token to one
+// request and presents it as "Authorization: Bearer <token>". This
+// replaces the legacy scheme in which the client's private key itself
+// was sent on every request (isValidClientKey), which DeprecatedPrivateKeyAuth
+// keeps available for migration.
+
+const (
+	jwsAlgRS256 = "RS256"
+	jwsAlgEdDSA = "EdDSA"
+	jwsAlgES256 = "ES256"
+	jwsAlgES384 = "ES384"
+)
+
+// jwsHeader is the JOSE header of a compact JWS bearer token. Kid names
+// the registered client whose stored public key should verify it.
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwsClaims is the signed payload of a bearer token. Binding it to the
+// exact method, path, and body hash of the request it accompanies, plus
+// a single-use nonce, means a captured token can't be replayed against a
+// different request or reused for the same one.
+type jwsClaims struct {
+	IssuedAt   int64  `json:"iat"`
+	ExpiresAt  int64  `json:"exp"`
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	BodySHA256 string `json:"body_sha256"`
+	Nonce      string `json:"nonce"`
+}
+
+func b64url(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func b64urlDecode(s string) ([]byte, error) { return base64.RawURLEncoding.DecodeString(s) }
+
+// validKeyAlgorithms is used both to validate a RegistrationOTP's
+// KeyAlgorithm field on load and in generateClientKeyPair's error
+// message.
+var validKeyAlgorithms = map[string]bool{
+	"": true, "rsa": true, "ecdsa-p256": true, "ecdsa-p384": true, "ed25519": true,
+}
+
+// generateClientKeyPair creates a new asymmetric key pair for a newly
+// registered client. algorithm selects "rsa" (the default, sized by
+// rsaKeySize), "ecdsa-p256", "ecdsa-p384", or "ed25519". It returns the
+// PEM-encoded private key, handed to the client once at registration time
+// and never stored server-side, and the PEM-encoded public key, which is
+// what RegisteredClient.PublicKey persists.
+func generateClientKeyPair(algorithm string, rsaKeySize int) (privateKeyPEM, publicKeyPEM string, err error) {
+	switch algorithm {
+	case "", "rsa":
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		priv := pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})
+		pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to marshal RSA public key: %w", err)
+		}
+		pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+		return string(priv), string(pub), nil
+
+	case "ecdsa-p256", "ecdsa-p384":
+		curve := elliptic.P256()
+		if algorithm == "ecdsa-p384" {
+			curve = elliptic.P384()
+		}
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate ECDSA key: %w", err)
+		}
+		privBytes, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to marshal ECDSA private key: %w", err)
+		}
+		privPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+		pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to marshal ECDSA public key: %w", err)
+		}
+		pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+		return string(privPEM), string(pubPEM), nil
+
+	case "ed25519":
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		privBytes, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to marshal Ed25519 private key: %w", err)
+		}
+		privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+		pubBytes, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to marshal Ed25519 public key: %w", err)
+		}
+		pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+		return string(privPEM), string(pubPEM), nil
+
+	default:
+		return "", "", fmt.Errorf("unknown client_key_algorithm %q (want \"rsa\", \"ecdsa-p256\", \"ecdsa-p384\", or \"ed25519\")", algorithm)
+	}
+}
+
+// verifyJWS validates a compact JWS bearer token against the request it
+// was presented with and the stored public key for the client named by
+// the token's kid header. maxSkew bounds how far iat/exp may drift from
+// the server's clock. It returns the authenticated client's name and
+// capabilities on success.
+func verifyJWS(token, method, path string, body []byte, maxSkew time.Duration) (clientName string, caps []string, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, false
+	}
+
+	headerJSON, err := b64urlDecode(parts[0])
+	if err != nil {
+		return "", nil, false
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil || header.Kid == "" {
+		return "", nil, false
+	}
+
+	payloadJSON, err := b64urlDecode(parts[1])
+	if err != nil {
+		return "", nil, false
+	}
+	var claims jwsClaims
+	if err := json.Unmarshal(payloadJSON, &claims); err != nil {
+		return "", nil, false
+	}
+
+	sig, err := b64urlDecode(parts[2])
+	if err != nil {
+		return "", nil, false
+	}
+
+	client, err := store.GetClientByName(header.Kid)
+	if err != nil {
+		log.Printf("JWS auth: no registered client for kid %q", header.Kid)
+		return "", nil, false
+	}
+	if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
+		log.Printf("JWS auth: client %s key has expired", header.Kid)
+		return "", nil, false
+	}
+	if client.Revoked {
+		log.Printf("JWS auth: client %s has been revoked", header.Kid)
+		return "", nil, false
+	}
+
+	block, _ := pem.Decode([]byte(client.PublicKey))
+	if block == nil {
+		return "", nil, false
+	}
+	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", nil, false
+	}
+
+	signingInput := parts[0] + "." + parts[1]
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != jwsAlgRS256 {
+			return "", nil, false
+		}
+		hashed := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+			return "", nil, false
+		}
+	case ed25519.PublicKey:
+		if header.Alg != jwsAlgEdDSA {
+			return "", nil, false
+		}
+		if !ed25519.Verify(key, []byte(signingInput), sig) {
+			return "", nil, false
+		}
+	case *ecdsa.PublicKey:
+		var hashed []byte
+		switch key.Curve {
+		case elliptic.P256():
+			if header.Alg != jwsAlgES256 {
+				return "", nil, false
+			}
+			h := sha256.Sum256([]byte(signingInput))
+			hashed = h[:]
+		case elliptic.P384():
+			if header.Alg != jwsAlgES384 {
+				return "", nil, false
+			}
+			h := sha512.Sum384([]byte(signingInput))
+			hashed = h[:]
+		default:
+			log.Printf("JWS auth: client %s has an unsupported ECDSA curve", header.Kid)
+			return "", nil, false
+		}
+		if !ecdsa.VerifyASN1(key, hashed, sig) {
+			return "", nil, false
+		}
+	default:
+		log.Printf("JWS auth: client %s has an unsupported key type", header.Kid)
+		return "", nil, false
+	}
+
+	now := time.Now()
+	iat := time.Unix(claims.IssuedAt, 0)
+	exp := time.Unix(claims.ExpiresAt, 0)
+	if now.After(exp.Add(maxSkew)) {
+		log.Printf("JWS auth: token for %s expired", header.Kid)
+		return "", nil, false
+	}
+	if now.Before(iat.Add(-maxSkew)) {
+		log.Printf("JWS auth: token for %s issued in the future", header.Kid)
+		return "", nil, false
+	}
+
+	if claims.Method != method || claims.Path != path {
+		log.Printf("JWS auth: token for %s is not bound to this request", header.Kid)
+		return "", nil, false
+	}
+
+	bodyHash := sha256.Sum256(body)
+	if claims.BodySHA256 != b64url(bodyHash[:]) {
+		log.Printf("JWS auth: token for %s has a body hash mismatch", header.Kid)
+		return "", nil, false
+	}
+
+	if claims.Nonce == "" || !nonces.claim(header.Kid, claims.Nonce, exp) {
+		log.Printf("JWS auth: token for %s reused a nonce", header.Kid)
+		return "", nil, false
+	}
+
+	go func(name string) {
+		if err := store.TouchClient(name, time.Now()); err != nil {
+			log.Printf("Error updating last-used time for %s: %v", name, err)
+		}
+	}(client.ClientName)
+
+	return client.ClientName, client.Capabilities, true
+}
+
+// nonceTracker remembers which (kid, nonce) pairs have already been
+// presented, so a JWS bearer token - valid only for the method/path/body
+// it was signed over - can't also be replayed a second time before it
+// expires. Entries are kept until the token's own exp, then pruned by
+// cleanupExpired.
+type nonceTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // "kid:nonce" -> expiry
+}
+
+func newNonceTracker() *nonceTracker {
+	return &nonceTracker{seen: make(map[string]time.Time)}
+}
+
+// claim records kid+nonce as seen and reports whether this use is
+// allowed, i.e. the pair had not already been claimed and not yet
+// expired.
+func (t *nonceTracker) claim(kid, nonce string, expiresAt time.Time) bool {
+	key := kid + ":" + nonce
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if exp, exists := t.seen[key]; exists && time.Now().Before(exp) {
+		return false
+	}
+	t.seen[key] = expiresAt
+	return true
+}
+
+// cleanupExpired prunes nonce entries whose token has already expired,
+// so the tracker doesn't grow without bound.
+func (t *nonceTracker) cleanupExpired() {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, exp := range t.seen {
+		if now.After(exp) {
+			delete(t.seen, key)
+		}
+	}
+}
+
+var nonces = newNonceTracker()
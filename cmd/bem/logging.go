@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
 )
@@ -13,74 +19,54 @@ import (
 var logger *slog.Logger
 var ginLogWriter io.Writer
 
-// InitLogger sets up the global logger with optional file rotation
+// levelVar backs the active handler's level so it can be changed at
+// runtime (see SetLogLevel) without rebuilding the slog.Handler.
+var levelVar = new(slog.LevelVar)
+
+// activeLogFile is the lumberjack writer currently in use, if LogToFile
+// is enabled. It is kept so CloseLogger can flush/close it and so a
+// scheduled rotation goroutine has something to call Rotate() on.
+var activeLogFile *lumberjack.Logger
+
+// logRotationCancel and logRotationDone control the background ticker
+// started by startLogRotation, so a later InitLogger call or CloseLogger
+// can stop it cleanly instead of leaking a goroutine.
+var logRotationCancel context.CancelFunc
+var logRotationDone chan struct{}
+
+// InitLogger sets up the global logger with optional file rotation. Any
+// scheduled rotation goroutine from a previous call is stopped first, so
+// InitLogger can safely be called again (e.g. on a config reload).
 func InitLogger(config Config) error {
-	var level slog.Level
+	stopLogRotation()
+	activeLogFile = nil
 
-	if config.Debug != 0 {
-		level = slog.LevelDebug
-	} else {
-		level = slog.LevelInfo
-	}
+	level := resolveLogLevel(config)
+	levelVar.Set(level)
 
-	// Create a handler with custom options
+	// Create a handler with custom options. Level is backed by levelVar,
+	// a slog.LevelVar, so SetLogLevel can raise/lower verbosity at
+	// runtime without rebuilding the handler.
 	handlerOpts := &slog.HandlerOptions{
-		Level:     level,
+		Level:     levelVar,
 		AddSource: config.Debug != 0,
 	}
 
-	// Determine output destination(s)
-	var writer io.Writer
-
-	if config.LogToFile {
-		// Set default log file path if not specified
-		logFilePath := config.LogFilePath
-		if logFilePath == "" {
-			logFilePath = "./logs/bem.log"
-		}
-
-		// Ensure log directory exists
-		logDir := filepath.Dir(logFilePath)
-		if err := os.MkdirAll(logDir, 0755); err != nil {
-			return fmt.Errorf("failed to create log directory: %w", err)
-		}
-
-		// Set default values for rotation parameters
-		maxSizeMB := config.LogMaxSizeMB
-		if maxSizeMB == 0 {
-			maxSizeMB = 100 // 100MB default
-		}
-		maxBackups := config.LogMaxBackups
-		if maxBackups == 0 {
-			maxBackups = 5
-		}
-		maxAgeDays := config.LogMaxAgeDays
-		if maxAgeDays == 0 {
-			maxAgeDays = 30
-		}
-
-		// Configure lumberjack for log rotation
-		fileWriter := &lumberjack.Logger{
-			Filename:   logFilePath,
-			MaxSize:    maxSizeMB,    // megabytes
-			MaxBackups: maxBackups,   // number of backups
-			MaxAge:     maxAgeDays,   // days
-			Compress:   config.LogCompress,
-		}
+	// Determine output destination(s): LogSinks (if set) selects one or
+	// more named sinks; otherwise fall back to the legacy
+	// LogToFile/LogToConsole booleans. See buildLogWriter.
+	writer, err := buildLogWriter(config)
+	if err != nil {
+		return err
+	}
 
-		// Combine console + file if both enabled
-		if config.LogToConsole {
-			writer = io.MultiWriter(os.Stdout, fileWriter)
-		} else {
-			writer = fileWriter
-		}
+	// Create handler with chosen writer and format
+	var handler slog.Handler
+	if strings.EqualFold(config.LogFormat, "json") {
+		handler = slog.NewJSONHandler(writer, handlerOpts)
 	} else {
-		// Console only (default behavior)
-		writer = os.Stdout
+		handler = slog.NewTextHandler(writer, handlerOpts)
 	}
-
-	// Create handler with chosen writer
-	handler := slog.NewTextHandler(writer, handlerOpts)
 	logger = slog.New(handler)
 
 	// Set as default logger
@@ -92,6 +78,8 @@ func InitLogger(config Config) error {
 	logger.Info("Logger initialized",
 		"level", level.String(),
 		"debug_mode", config.Debug != 0,
+		"log_format", config.LogFormat,
+		"log_sinks", config.LogSinks,
 		"log_to_file", config.LogToFile,
 		"log_file_path", config.LogFilePath,
 		"log_to_console", config.LogToConsole,
@@ -100,6 +88,181 @@ func InitLogger(config Config) error {
 	return nil
 }
 
+// legacyLogWriter implements the pre-LogSinks behavior: console,
+// optionally combined with a rotated file, selected via
+// LogToFile/LogToConsole.
+func legacyLogWriter(config Config) (io.Writer, error) {
+	if !config.LogToFile {
+		return os.Stdout, nil
+	}
+
+	fileWriter, err := newFileWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	activeLogFile = fileWriter
+
+	if err := maybeStartRotation(config, fileWriter); err != nil {
+		return nil, err
+	}
+
+	if config.LogToConsole {
+		return io.MultiWriter(os.Stdout, fileWriter), nil
+	}
+	return fileWriter, nil
+}
+
+// newFileWriter builds the lumberjack writer for the main application
+// log file, applying InitLogger's historical size/backup/age defaults.
+func newFileWriter(config Config) (*lumberjack.Logger, error) {
+	logFilePath := config.LogFilePath
+	if logFilePath == "" {
+		logFilePath = "./logs/bem.log"
+	}
+
+	logDir := filepath.Dir(logFilePath)
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	maxSizeMB := config.LogMaxSizeMB
+	if maxSizeMB == 0 {
+		maxSizeMB = 100 // 100MB default
+	}
+	maxBackups := config.LogMaxBackups
+	if maxBackups == 0 {
+		maxBackups = 5
+	}
+	maxAgeDays := config.LogMaxAgeDays
+	if maxAgeDays == 0 {
+		maxAgeDays = 30
+	}
+
+	return &lumberjack.Logger{
+		Filename:   logFilePath,
+		MaxSize:    maxSizeMB,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAgeDays,
+		Compress:   config.LogCompress,
+	}, nil
+}
+
+// maybeStartRotation parses LogRotationInterval (if set) and starts the
+// scheduled rotation goroutine for fileWriter.
+func maybeStartRotation(config Config, fileWriter *lumberjack.Logger) error {
+	if config.LogRotationInterval == "" {
+		return nil
+	}
+
+	interval, err := time.ParseDuration(config.LogRotationInterval)
+	if err != nil {
+		return fmt.Errorf("invalid log_rotation_interval %q: %w", config.LogRotationInterval, err)
+	}
+	if interval > 0 {
+		startLogRotation(fileWriter, interval)
+	}
+	return nil
+}
+
+// resolveLogLevel picks the initial slog.Level from config.LogLevel
+// ("DEBUG", "INFO", "WARN", or "ERROR"), falling back to config.Debug
+// for backward compatibility when LogLevel is unset.
+func resolveLogLevel(config Config) slog.Level {
+	if config.LogLevel != "" {
+		switch strings.ToUpper(config.LogLevel) {
+		case "DEBUG":
+			return slog.LevelDebug
+		case "WARN", "WARNING":
+			return slog.LevelWarn
+		case "ERROR":
+			return slog.LevelError
+		default:
+			return slog.LevelInfo
+		}
+	}
+
+	if config.Debug != 0 {
+		return slog.LevelDebug
+	}
+	return slog.LevelInfo
+}
+
+// SetLogLevel changes the active logger's verbosity threshold at
+// runtime, without rebuilding the slog.Handler. See the /admin/log-level
+// endpoint.
+func SetLogLevel(level slog.Level) {
+	levelVar.Set(level)
+}
+
+// CurrentLogLevel returns the logger's current verbosity threshold.
+func CurrentLogLevel() slog.Level {
+	return levelVar.Level()
+}
+
+// ParseLogLevel maps a log_level string ("debug", "info", "warn",
+// "error", case-insensitively) to its slog.Level, for use by the
+// /admin/log-level endpoint and SIGHUP config reload.
+func ParseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToUpper(s) {
+	case "DEBUG":
+		return slog.LevelDebug, nil
+	case "INFO":
+		return slog.LevelInfo, nil
+	case "WARN", "WARNING":
+		return slog.LevelWarn, nil
+	case "ERROR":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn, or error)", s)
+	}
+}
+
+// watchSIGHUP re-reads configPath on every SIGHUP and reapplies its
+// logging settings (level, sinks/file destination, rotation) via
+// InitLogger, so an operator can change log_level or log_file_path and
+// pick it up with `kill -HUP` instead of a restart. It never returns.
+func watchSIGHUP(configPath string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	for range sighup {
+		GetLogger().Info("Received SIGHUP, reloading logging configuration", "config_file", configPath)
+
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			GetLogger().Error("SIGHUP reload: failed to read config file", "error", err)
+			continue
+		}
+
+		var config Config
+		if err := json.Unmarshal(data, &config); err != nil {
+			GetLogger().Error("SIGHUP reload: failed to parse config file", "error", err)
+			continue
+		}
+
+		if err := InitLogger(config); err != nil {
+			GetLogger().Error("SIGHUP reload: failed to reinitialize logger", "error", err)
+			continue
+		}
+
+		appConfig = &config
+		GetLogger().Info("Logging configuration reloaded from SIGHUP")
+	}
+}
+
+// LoggerFromContext returns a logger pre-bound with the request's
+// correlation ID (see RequestIDMiddleware), so code holding only a
+// context.Context - not a gin.Context - can still emit correlated log
+// lines without threading request_id through every call. Falls back to
+// the package logger if ctx carries no request ID.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	l := GetLogger()
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok && id != "" {
+		return l.With("request_id", id)
+	}
+	return l
+}
+
 // GetLogger returns the configured logger instance
 func GetLogger() *slog.Logger {
 	if logger == nil {
@@ -116,3 +279,70 @@ func GetGinLogWriter() io.Writer {
 	}
 	return ginLogWriter
 }
+
+// startLogRotation runs fileWriter.Rotate() on a time.Ticker at the
+// given cadence, so logs roll over on a schedule even if they never hit
+// LogMaxSizeMB. It replaces any previously running rotation goroutine.
+func startLogRotation(fileWriter *lumberjack.Logger, interval time.Duration) {
+	stopLogRotation()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	logRotationCancel = cancel
+	logRotationDone = done
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := fileWriter.Rotate(); err != nil {
+					GetLogger().Error("Scheduled log rotation failed", "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopLogRotation cancels the rotation goroutine started by
+// startLogRotation, if any, and waits for it to exit.
+func stopLogRotation() {
+	if logRotationCancel == nil {
+		return
+	}
+	logRotationCancel()
+	<-logRotationDone
+	logRotationCancel = nil
+	logRotationDone = nil
+}
+
+// CloseLogger stops any scheduled rotation goroutine and closes the
+// active log file, if logging to a file is enabled. Call it from main's
+// shutdown path; ctx bounds how long to wait for the rotation goroutine
+// to stop.
+func CloseLogger(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		stopLogRotation()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if activeLogFile == nil {
+		return nil
+	}
+	err := activeLogFile.Close()
+	activeLogFile = nil
+	return err
+}
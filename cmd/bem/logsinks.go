@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/journal"
+)
+
+// SyslogConfig configures the "syslog" log sink. Network/Address select
+// a remote syslog server via log/syslog.Dial; leaving both empty dials
+// the local syslog daemon over its usual unix socket. Only honored on
+// unix-like platforms; see newSyslogWriter.
+type SyslogConfig struct {
+	Network  string `json:"network"`  // "", "tcp", or "udp"
+	Address  string `json:"address"`  // required when Network is set
+	Facility string `json:"facility"` // "daemon" (default), "user", "mail", "cron", or "local0".."local7"
+	Tag      string `json:"tag"`      // process tag attached to each message (default "bem")
+}
+
+// buildLogWriter resolves the configured output destination(s) into a
+// single io.Writer. When LogSinks is set it takes precedence and builds
+// an io.MultiWriter over each named sink ("stdout", "file", "syslog",
+// "journald", "eventlog"); otherwise it falls back to the legacy
+// LogToFile/LogToConsole booleans for backward compatibility.
+func buildLogWriter(config Config) (io.Writer, error) {
+	if len(config.LogSinks) == 0 {
+		return legacyLogWriter(config)
+	}
+
+	writers := make([]io.Writer, 0, len(config.LogSinks))
+	for _, sink := range config.LogSinks {
+		w, err := buildSinkWriter(strings.ToLower(sink), config)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	if len(writers) == 0 {
+		return io.Discard, nil
+	}
+	return io.MultiWriter(writers...), nil
+}
+
+// buildSinkWriter constructs the writer for a single log_sinks entry.
+// syslog/journald/eventlog each surface a clear error here rather than
+// silently dropping logs when the sink is unavailable on this platform
+// or host.
+func buildSinkWriter(sink string, config Config) (io.Writer, error) {
+	switch sink {
+	case "stdout":
+		return os.Stdout, nil
+
+	case "file":
+		fw, err := newFileWriter(config)
+		if err != nil {
+			return nil, err
+		}
+		activeLogFile = fw
+		if err := maybeStartRotation(config, fw); err != nil {
+			return nil, err
+		}
+		return fw, nil
+
+	case "syslog":
+		w, err := newSyslogWriter(config.Syslog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize syslog sink: %w", err)
+		}
+		return w, nil
+
+	case "journald":
+		w, err := newJournaldWriter()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize journald sink: %w", err)
+		}
+		return w, nil
+
+	case "eventlog":
+		w, err := newEventLogWriter(config.EventLogSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize eventlog sink: %w", err)
+		}
+		return w, nil
+
+	default:
+		return nil, fmt.Errorf("unknown log_sinks entry %q (want stdout, file, syslog, journald, or eventlog)", sink)
+	}
+}
+
+// journaldWriter forwards slog output to the local systemd journal. When
+// the logger is configured with log_format "json" it parses each line
+// to recover the level (mapped to a journal priority) and the message,
+// and forwards any remaining attributes as journald KEY=value fields;
+// with the default text format every line is sent at PriInfo as a single
+// MESSAGE field.
+type journaldWriter struct{}
+
+func newJournaldWriter() (io.Writer, error) {
+	if !journal.Enabled() {
+		return nil, fmt.Errorf("systemd journal is not available on this host")
+	}
+	return journaldWriter{}, nil
+}
+
+func (journaldWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+
+	message := line
+	priority := journal.PriInfo
+	vars := map[string]string{}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err == nil {
+		if lvl, ok := fields["level"].(string); ok {
+			priority = journalPriorityForLevel(lvl)
+		}
+		if msg, ok := fields["msg"].(string); ok {
+			message = msg
+		}
+		for k, v := range fields {
+			if k == "msg" || k == "level" || k == "time" {
+				continue
+			}
+			vars[strings.ToUpper(k)] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	if err := journal.Send(message, priority, vars); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func journalPriorityForLevel(level string) journal.Priority {
+	switch strings.ToUpper(level) {
+	case "DEBUG":
+		return journal.PriDebug
+	case "INFO":
+		return journal.PriInfo
+	case "WARN", "WARNING":
+		return journal.PriWarning
+	case "ERROR":
+		return journal.PriErr
+	default:
+		return journal.PriInfo
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// newEventLogWriter reports that the eventlog sink is unavailable:
+// Windows Event Log access requires golang.org/x/sys/windows, which
+// only builds on GOOS=windows.
+func newEventLogWriter(source string) (io.Writer, error) {
+	return nil, fmt.Errorf("eventlog sink is only supported on windows")
+}
@@ -0,0 +1,46 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// newEventLogWriter opens a Windows Event Log source, registering it
+// first if it doesn't already exist. source defaults to "BigFix Mobile
+// Enterprise" when empty.
+func newEventLogWriter(source string) (io.Writer, error) {
+	if source == "" {
+		source = "BigFix Mobile Enterprise"
+	}
+
+	elog, err := eventlog.Open(source)
+	if err != nil {
+		if instErr := eventlog.InstallAsEventCreate(source, eventlog.Info|eventlog.Warning|eventlog.Error); instErr != nil {
+			return nil, fmt.Errorf("failed to register event source %q: %w", source, instErr)
+		}
+		elog, err = eventlog.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open event source %q: %w", source, err)
+		}
+	}
+
+	return eventLogWriter{elog}, nil
+}
+
+// eventLogWriter adapts an eventlog.Log to io.Writer. Every line is
+// reported at Info severity: like the syslog sink, slog's Handler
+// interface offers no per-record hook to vary it.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	if err := w.elog.Info(1, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"strings"
+)
+
+// newSyslogWriter dials the configured syslog daemon. Every slog record
+// is sent at the same severity (LOG_INFO): slog's Handler interface
+// writes pre-formatted bytes to a single io.Writer with no per-record
+// transport hook, so there's no way to vary syslog severity per line.
+func newSyslogWriter(cfg SyslogConfig) (io.Writer, error) {
+	facility, err := parseSyslogFacility(cfg.Facility)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "bem"
+	}
+
+	return syslog.Dial(cfg.Network, cfg.Address, facility|syslog.LOG_INFO, tag)
+}
+
+func parseSyslogFacility(name string) (syslog.Priority, error) {
+	switch strings.ToLower(name) {
+	case "", "daemon":
+		return syslog.LOG_DAEMON, nil
+	case "user":
+		return syslog.LOG_USER, nil
+	case "mail":
+		return syslog.LOG_MAIL, nil
+	case "cron":
+		return syslog.LOG_CRON, nil
+	case "local0":
+		return syslog.LOG_LOCAL0, nil
+	case "local1":
+		return syslog.LOG_LOCAL1, nil
+	case "local2":
+		return syslog.LOG_LOCAL2, nil
+	case "local3":
+		return syslog.LOG_LOCAL3, nil
+	case "local4":
+		return syslog.LOG_LOCAL4, nil
+	case "local5":
+		return syslog.LOG_LOCAL5, nil
+	case "local6":
+		return syslog.LOG_LOCAL6, nil
+	case "local7":
+		return syslog.LOG_LOCAL7, nil
+	default:
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// newSyslogWriter reports that the syslog sink is unavailable: log/syslog
+// only builds on unix-like platforms.
+func newSyslogWriter(cfg SyslogConfig) (io.Writer, error) {
+	return nil, fmt.Errorf("syslog sink is only supported on unix-like platforms")
+}
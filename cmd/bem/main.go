@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -18,6 +19,9 @@ import (
 func main() {
 	configFile := flag.String("c", "./bem.json", "Path to the config file")
 	showVersion := flag.Bool("version", false, "Display version information and exit")
+	checkMode := flag.Bool("check", false, "Run a one-shot readiness check against configured BigFix servers and exit (for container readiness/health probes)")
+	retryTimeout := flag.Duration("retry-timeout", 60*time.Second, "With -check, how long to retry BigFix connectivity before giving up")
+	retrySleep := flag.Duration("retry-sleep", 2*time.Second, "With -check, how long to sleep between retry attempts")
 	flag.Parse()
 
 	// Handle --version flag
@@ -46,12 +50,43 @@ func main() {
 
 	// Make config globally accessible
 	appConfig = &config
+	configFilePath = *configFile
 
 	// Initialize logger with full config
 	if err := InitLogger(config); err != nil {
 		slog.Error("Failed to initialize logger", "error", err)
 		os.Exit(1)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		CloseLogger(ctx)
+	}()
+
+	if err := initAccessLog(config.AccessLog); err != nil {
+		slog.Error("Failed to initialize access log", "error", err)
+		os.Exit(1)
+	}
+	defer closeAccessLog()
+
+	if err := InitErrorReporter(config.ErrorReporter); err != nil {
+		slog.Error("Failed to initialize error reporter", "driver", config.ErrorReporter.Driver, "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := errorReporter.Flush(ctx); err != nil {
+			slog.Error("Failed to flush error reporter", "error", err)
+		}
+	}()
+
+	// -check runs a readiness probe against the configured BigFix servers
+	// and exits, without starting the HTTP server, registration watcher,
+	// or interactive CLI.
+	if *checkMode {
+		os.Exit(runCheckMode(config, *retryTimeout, *retrySleep))
+	}
 
 	slog.Info("Starting application",
 		"name", app_desc,
@@ -61,37 +96,58 @@ func main() {
 
 	// Set up configuration directory for persistent storage
 	configDir = filepath.Dir(*configFile)
-	
+
 	// Set default registration data directory if not configured
 	registrationDataDir = config.RegistrationDataDir
 	if registrationDataDir == "" {
 		registrationDataDir = configDir // fallback to config directory
 	}
 
-	// Load existing registration data
-	if err := loadRegistrationOTPs(); err != nil {
-		slog.Error("Failed to load registration OTPs", "error", err)
+	// Open the persistence backend for registration OTPs, registered
+	// clients, and admin sessions.
+	store, err = newStorage(config)
+	if err != nil {
+		slog.Error("Failed to initialize storage backend", "driver", config.Storage.Driver, "error", err)
 		os.Exit(1)
 	}
+	defer store.Close()
 
-	if err := loadRegisteredClients(); err != nil {
-		slog.Error("Failed to load registered clients", "error", err)
+	if otps, err := store.ListOTPs(); err == nil {
+		if clients, err := store.ListClients(); err == nil {
+			slog.Debug("Loaded registration data", "otp_count", len(otps), "client_count", len(clients))
+		}
+	}
+
+	// Load (or bootstrap) the client enrollment CA used to sign CSRs
+	// presented to /register; see issueCertificateForClient.
+	if err := initClientCA(config.ClientCA); err != nil {
+		slog.Error("Failed to initialize client CA", "error", err)
+		os.Exit(1)
+	}
+
+	// Register the configured registration-lifecycle event subscribers
+	// (webhook and/or syslog); see initEventSubscribers.
+	if err := initEventSubscribers(config.EventSubscribers); err != nil {
+		slog.Error("Failed to initialize event subscribers", "error", err)
 		os.Exit(1)
 	}
 
-	slog.Debug("Loaded registration data",
-		"otp_count", len(registrationOTPs),
-		"client_count", len(registeredClients))
-	
 	// Start registration directory monitoring
 	go watchRegistrationDirectory(config.RegistrationDir)
-	
-	// Start periodic session cleanup (every 30 minutes)
+
+	// Reload logging config (level, file destination, rotation) on
+	// SIGHUP without restarting the process.
+	go watchSIGHUP(*configFile)
+
+	// Start periodic session, OTP/client, and JWS nonce cleanup (every
+	// 30 minutes)
+	otpTTL := otpTTLFromConfig(config.OTPTTLHours)
 	go func() {
 		ticker := time.NewTicker(30 * time.Minute)
 		defer ticker.Stop()
 		for range ticker.C {
-			cleanupExpiredSessions()
+			cleanupExpiredSessions(otpTTL)
+			nonces.cleanupExpired()
 		}
 	}()
 
@@ -114,8 +170,13 @@ func main() {
 	slog.Info("Initializing BigFix server connections",
 		"server_count", len(config.BigFixServers))
 
+	backendCfg := backendConfigFrom(config)
+
 	for _, server := range config.BigFixServers {
-		cache.AddServer(server.URL, server.Username, server.Password, server.PoolSize, server.MaxAge)
+		if err := addServerToCache(cache, server, backendCfg); err != nil {
+			slog.Error("Failed to add BigFix server", "url", server.URL, "error", err)
+			continue
+		}
 		go cache.PopulateCoreTypes(server.URL, server.MaxAge)
 		slog.Debug("Added BigFix server",
 			"url", server.URL,
@@ -126,6 +187,19 @@ func main() {
 	// Start the garbage collector after cache is initialized with servers
 	cache.StartGarbageCollector(config.GarbageCollectorInterval)
 
+	// Configure the optional bounded hot tier / disk-backed tier.
+	// Left at their zero values, the cache stays unbounded and
+	// memory-only, matching pre-existing behavior.
+	cache.HotEntries = config.CacheHotEntries
+	cache.HotBytes = config.CacheHotBytes
+	cache.MaxTotalBytes = config.CacheMaxTotalBytes
+	cache.DiskDir = config.CacheDiskDir
+	cache.DiskBytes = config.CacheDiskBytes
+	cache.MaxPayloadSize = config.CacheMaxPayloadSize
+	cache.StaleWhileRevalidate = config.CacheStaleWhileRevalidate
+	cache.StaleIfError = config.CacheStaleIfError
+	cache.StartDiskJanitor(config.GarbageCollectorInterval)
+
 	// Keep Gin in debug mode (default) to enable colorized [GIN] HTTP request logs
 	// These logs always go to console regardless of log_level setting
 	// Note: This is separate from application log level which controls slog output
@@ -133,9 +207,20 @@ func main() {
 	// Create Gin router with custom middleware
 	r := gin.New()
 
+	// Gin trusts every proxy by default, which would let any client set
+	// ClientIP() to whatever it likes via X-Forwarded-For/X-Real-IP -
+	// defeating RegistrationOTP.AllowedCIDRs (see ipAllowed in
+	// auth.go). TrustedProxies defaults to empty, so this disables
+	// that trust unless an operator explicitly configures the reverse
+	// proxies in front of this server.
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted_proxies configuration", "error", err)
+		os.Exit(1)
+	}
+
 	// Configure Gin to always write colorized HTTP request logs to console
-	gin.DefaultWriter = GetGinLogWriter()       // Always os.Stdout
-	gin.DefaultErrorWriter = GetGinLogWriter()  // Always os.Stdout
+	gin.DefaultWriter = GetGinLogWriter()      // Always os.Stdout
+	gin.DefaultErrorWriter = GetGinLogWriter() // Always os.Stdout
 
 	// Add Gin's default logger middleware (provides colorized [GIN] HTTP request logs to console)
 	r.Use(gin.LoggerWithWriter(GetGinLogWriter()))
@@ -145,28 +230,77 @@ func main() {
 	logger := GetLogger()
 	r.Use(RequestLoggingMiddleware(logger))
 
+	// Add the dedicated access-log stream (no-op unless config.access_log.enabled)
+	r.Use(AccessLoggingMiddleware())
+
 	// Add recovery and error logging middleware
 	r.Use(RecoveryMiddleware(logger))
 	r.Use(ErrorLoggingMiddleware(logger))
 
+	// Advertise the HTTP/3 listener (if enabled) so clients can upgrade
+	if config.EnableHTTP3 {
+		quicPort := config.QUICPort
+		if quicPort == 0 {
+			quicPort = config.ListenPort
+		}
+		r.Use(AltSvcMiddleware(quicPort))
+	}
+
 	// Set up all routes
 	setupRoutes(r, cache, config)
 
-	// Validate TLS configuration (HTTPS-only server)
-	if config.KeyPath == "" || config.CertPath == "" {
+	// Validate TLS configuration (HTTPS-only server). AutoTLS obtains its
+	// certificate from ACME, so CertPath/KeyPath aren't required then.
+	if !config.AutoTLS && (config.KeyPath == "" || config.CertPath == "") {
 		slog.Error("TLS certificate and key are required - HTTP-only mode is not supported")
 		os.Exit(1)
 	}
 
 	// Start HTTPS server in goroutine
 	go func() {
-		err := StartTLSServer(r, config.CertPath, config.KeyPath, config.ListenPort, logger)
+		var mtls *MTLSOptions
+		if config.MTLSClientCAPath != "" {
+			mtls = &MTLSOptions{
+				ClientCAPath:      config.MTLSClientCAPath,
+				RequireClientCert: config.MTLSRequireClientCert,
+			}
+		}
+
+		var autoTLS *AutoTLSOptions
+		if config.AutoTLS {
+			autoTLS = &AutoTLSOptions{
+				Domains:  config.AutoTLSDomains,
+				Email:    config.AutoTLSEmail,
+				CacheDir: config.AutoTLSCacheDir,
+			}
+		}
+
+		err := StartTLSServer(r, config.CertPath, config.KeyPath, config.ListenPort, logger, mtls, autoTLS)
 		if err != nil {
 			slog.Error("Server error", "error", err)
 			os.Exit(1)
 		}
 	}()
 
+	// Start HTTP/3 (QUIC) listener in goroutine, if enabled. This reuses
+	// the static certificate/key, so it's skipped under AutoTLS where no
+	// fixed keypair exists on disk.
+	if config.EnableHTTP3 {
+		if config.AutoTLS {
+			slog.Warn("enable_http3 is set but auto_tls is enabled; HTTP/3 requires a static cert_path/key_path, skipping")
+		} else {
+			quicPort := config.QUICPort
+			if quicPort == 0 {
+				quicPort = config.ListenPort
+			}
+			go func() {
+				if err := StartQUICServer(r, config.CertPath, config.KeyPath, quicPort, logger); err != nil {
+					slog.Error("QUIC server error", "error", err)
+				}
+			}()
+		}
+	}
+
 	// Initialize readline for command history and line editing
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          "bem> ",
@@ -217,10 +351,10 @@ func main() {
 				}
 				var entries []cacheEntry
 
-				server.CacheMap.Range(func(key, value interface{}) bool {
+				server.CacheMap.Range(func(key string, item *bfrest.CacheItem) bool {
 					entries = append(entries, cacheEntry{
-						url:  key.(string),
-						item: value.(*bfrest.CacheItem),
+						url:  key,
+						item: item,
 					})
 					return true
 				})
@@ -339,10 +473,9 @@ func main() {
 				serverData["MaxAge"] = server.MaxAge
 				serverData["CacheItems"] = make([]map[string]interface{}, 0)
 
-				server.CacheMap.Range(func(key, value interface{}) bool {
-					cacheItem := value.(*bfrest.CacheItem)
+				server.CacheMap.Range(func(key string, cacheItem *bfrest.CacheItem) bool {
 					itemData := make(map[string]interface{})
-					itemData["URL"] = key.(string)
+					itemData["URL"] = key
 					itemData["Timestamp"] = cacheItem.Timestamp
 					itemData["MaxAge"] = cacheItem.MaxAge
 					itemData["BaseMaxAge"] = cacheItem.BaseMaxAge
@@ -383,8 +516,7 @@ func main() {
 				var maxAge, minAge uint64
 				firstItem := true
 
-				server.CacheMap.Range(func(key, value interface{}) bool {
-					v := value.(*bfrest.CacheItem)
+				server.CacheMap.Range(func(key string, v *bfrest.CacheItem) bool {
 					count++
 					ramBytes += int64(len(v.Json))
 
@@ -431,12 +563,16 @@ func main() {
 			fmt.Println("\n=== REGISTRATION STATUS ===")
 
 			// Registration Requests (OTPs)
-			registrationMutex.RLock()
-			fmt.Printf("\nRegistration Requests (%d):\n", len(registrationOTPs))
-			if len(registrationOTPs) == 0 {
+			otps, err := store.ListOTPs()
+			if err != nil {
+				fmt.Println("Error listing registration OTPs:", err)
+				continue
+			}
+			fmt.Printf("\nRegistration Requests (%d):\n", len(otps))
+			if len(otps) == 0 {
 				fmt.Println("  (none)")
 			} else {
-				for i, otp := range registrationOTPs {
+				for i, otp := range otps {
 					fmt.Printf("  %d. %s\n", i+1, otp.ClientName)
 					fmt.Printf("     Key: %s\n", otp.OneTimeKey)
 					fmt.Printf("     Created: %s\n", otp.CreatedAt.Format("2006-01-02 15:04:05"))
@@ -449,11 +585,16 @@ func main() {
 			}
 
 			// Registered Clients
-			fmt.Printf("Registered Clients (%d):\n", len(registeredClients))
-			if len(registeredClients) == 0 {
+			clients, err := store.ListClients()
+			if err != nil {
+				fmt.Println("Error listing registered clients:", err)
+				continue
+			}
+			fmt.Printf("Registered Clients (%d):\n", len(clients))
+			if len(clients) == 0 {
 				fmt.Println("  (none)")
 			} else {
-				for i, client := range registeredClients {
+				for i, client := range clients {
 					fmt.Printf("  %d. %s\n", i+1, client.ClientName)
 					fmt.Printf("     Registered: %s\n", client.RegisteredAt.Format("2006-01-02 15:04:05"))
 					if client.ExpiresAt != nil {
@@ -466,29 +607,25 @@ func main() {
 					fmt.Println()
 				}
 			}
-			registrationMutex.RUnlock()
 
 			// Active Sessions
-			sessionMutex.RLock()
-			fmt.Printf("Active OTP Sessions (%d):\n", len(activeSessions))
-			if len(activeSessions) == 0 {
+			sessions, err := store.ListSessions()
+			if err != nil {
+				fmt.Println("Error listing active sessions:", err)
+				continue
+			}
+			fmt.Printf("Active OTP Sessions (%d):\n", len(sessions))
+			if len(sessions) == 0 {
 				fmt.Println("  (none)")
 			} else {
-				i := 1
-				now := time.Now()
-				for token, expiresAt := range activeSessions {
-					status := "Active"
-					if now.After(expiresAt) {
-						status = "Expired"
-					}
-					fmt.Printf("  %d. Session Token: %s...\n", i, token[:8])
-					fmt.Printf("     Expires: %s\n", expiresAt.Format("2006-01-02 15:04:05"))
-					fmt.Printf("     Status: %s\n", status)
+				for i, session := range sessions {
+					fmt.Printf("  %d. Session Token: %s...\n", i+1, session.Token[:8])
+					fmt.Printf("     Client: %s\n", session.ClientName)
+					fmt.Printf("     Expires: %s\n", session.ExpiresAt.Format("2006-01-02 15:04:05"))
+					fmt.Printf("     Capabilities: %s\n", strings.Join(session.Capabilities, ", "))
 					fmt.Println()
-					i++
 				}
 			}
-			sessionMutex.RUnlock()
 
 			continue
 		}
@@ -522,4 +659,4 @@ func main() {
 
 		fmt.Println(cache.Get(query))
 	}
-}
\ No newline at end of file
+}
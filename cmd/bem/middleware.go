@@ -1,12 +1,170 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"fmt"
 	"log/slog"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// requestIDHeader is the header used to propagate a per-request
+// correlation ID to and from clients.
+const requestIDHeader = "X-Request-ID"
+
+// traceparentHeader is the W3C Trace Context header honored as a
+// fallback correlation ID source when X-Request-ID is absent.
+const traceparentHeader = "traceparent"
+
+// requestIDContextKeyType avoids collisions with other packages' context
+// keys; requestIDContextKey is the single value of this type BEM uses.
+type requestIDContextKeyType struct{}
+
+var requestIDContextKey = requestIDContextKeyType{}
+
+// RequestIDMiddleware assigns a request ID (or echoes an inbound
+// X-Request-ID or traceparent header), stashes it in the gin context and
+// on c.Request.Context(), and reflects it back on the response so every
+// log line and error body for this request can be correlated.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if requestID == "" {
+			requestID = parseTraceparentTraceID(c.GetHeader(traceparentHeader))
+		}
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
+
+		c.Set("request_id", requestID)
+		c.Writer.Header().Set(requestIDHeader, requestID)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextKey, requestID))
+
+		c.Next()
+	}
+}
+
+// parseTraceparentTraceID extracts the trace-id field from a W3C
+// traceparent header value ("version-traceid-parentid-flags"), or
+// returns "" if the header isn't well-formed enough to use.
+func parseTraceparentTraceID(value string) string {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+func generateRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// GetRequestID returns the request ID stashed by RequestIDMiddleware,
+// or "" if it hasn't run for this request.
+func GetRequestID(c *gin.Context) string {
+	if id, ok := c.Get("request_id"); ok {
+		if s, ok := id.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// ConfigMiddleware stashes the application config in the gin context so
+// handlers can pull it via c.MustGet("config") instead of taking it as
+// an argument.
+func ConfigMiddleware(config Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("config", config)
+		c.Next()
+	}
+}
+
+// AuthMiddleware resolves the request's session cookie or client key
+// into a capability set exactly once per request and stores the result
+// in the gin context (keys: "authenticated", "client_name",
+// "capabilities"). It never aborts the chain; routes that require
+// authentication use RequireCap to enforce it.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("authenticated", isAuthenticatedRequest(c))
+		c.Next()
+	}
+}
+
+// RequireCap returns a middleware that aborts with 401/403 unless the
+// resolved session or client key (via AuthMiddleware) carries the given
+// capability. Use it per-route: r.GET("/urls", RequireCap("query:read"), handler).
+func RequireCap(capability string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticated, _ := c.Get("authenticated")
+		if ok, _ := authenticated.(bool); !ok {
+			c.JSON(401, gin.H{
+				"error":      "Authentication required. Please visit /otp?OneTimeKey=<key> or register your client.",
+				"request_id": GetRequestID(c),
+			})
+			c.Abort()
+			return
+		}
+
+		if !requireCapability(c, capability) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// readOnlyMode is the live, runtime-toggleable read-only flag. It is
+// seeded from Config.ReadOnly at startup but can be flipped afterwards
+// without a restart.
+var readOnlyMode int32
+
+// SetReadOnly flips the server's runtime read-only state.
+func SetReadOnly(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&readOnlyMode, v)
+}
+
+// IsReadOnly reports the server's current read-only state.
+func IsReadOnly() bool {
+	return atomic.LoadInt32(&readOnlyMode) != 0
+}
+
+// readOnlyWhitelist lists paths that remain reachable (for any method)
+// while the server is in read-only mode.
+var readOnlyWhitelist = map[string]bool{
+	"/healthz": true,
+}
+
+// ReadOnlyMiddleware returns 503 for any non-GET method while the
+// server is in read-only mode, except for a small whitelist of paths
+// (health checks) that must stay reachable regardless.
+func ReadOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsReadOnly() && c.Request.Method != "GET" && !readOnlyWhitelist[c.Request.URL.Path] {
+			c.JSON(503, gin.H{
+				"error":      "Server is in read-only mode",
+				"request_id": GetRequestID(c),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // RequestLoggingMiddleware logs detailed information about each HTTP request using slog.
 // This provides structured logging separate from Gin's colorized [GIN] console logs.
 //
@@ -36,6 +194,7 @@ func RequestLoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
 			"user_agent", c.Request.UserAgent(),
 			"content_type", c.Request.Header.Get("Content-Type"),
 			"has_auth", c.Request.Header.Get("Authorization") != "",
+			"request_id", GetRequestID(c),
 		)
 
 		// Process request
@@ -62,6 +221,7 @@ func RequestLoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
 			"duration_ms", duration.Milliseconds(),
 			"client_ip", clientIP,
 			"bytes_written", c.Writer.Size(),
+			"request_id", GetRequestID(c),
 		)
 	}
 }
@@ -80,26 +240,66 @@ func ErrorLoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
 					"method", c.Request.Method,
 					"path", c.Request.URL.Path,
 					"client_ip", c.ClientIP(),
+					"request_id", GetRequestID(c),
 				)
+
+				if c.Writer.Status() >= 500 {
+					errorReporter.Report(c.Request.Context(), err.Err, map[string]any{
+						"method":     c.Request.Method,
+						"path":       c.Request.URL.Path,
+						"client_ip":  c.ClientIP(),
+						"request_id": GetRequestID(c),
+					})
+				}
 			}
 		}
 	}
 }
 
+// AltSvcMiddleware advertises the server's HTTP/3 listener so clients
+// that support QUIC can upgrade future requests to it (see
+// StartQUICServer). quicPort is the UDP port the HTTP/3 listener is
+// bound to.
+func AltSvcMiddleware(quicPort int) gin.HandlerFunc {
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=2592000`, quicPort)
+	return func(c *gin.Context) {
+		c.Writer.Header().Set("Alt-Svc", altSvc)
+		c.Next()
+	}
+}
+
+// maxRecoveryStackFrames bounds the stack trace captured by
+// RecoveryMiddleware, so a deeply recursive panic doesn't blow up log
+// line size.
+const maxRecoveryStackFrames = 32
+
 // RecoveryMiddleware recovers from panics and logs them
 func RecoveryMiddleware(logger *slog.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		defer func() {
-			if err := recover(); err != nil {
+			if rec := recover(); rec != nil {
+				stack := captureStack(3, maxRecoveryStackFrames)
+
 				logger.Error("Panic recovered",
-					"error", err,
+					"error", rec,
+					"stack", stack,
 					"method", c.Request.Method,
 					"path", c.Request.URL.Path,
 					"client_ip", c.ClientIP(),
+					"request_id", GetRequestID(c),
 				)
 
+				errorReporter.Report(c.Request.Context(), panicError(rec), map[string]any{
+					"stack":      stack,
+					"method":     c.Request.Method,
+					"path":       c.Request.URL.Path,
+					"client_ip":  c.ClientIP(),
+					"request_id": GetRequestID(c),
+				})
+
 				c.JSON(500, gin.H{
-					"error": "Internal server error",
+					"error":      "Internal server error",
+					"request_id": GetRequestID(c),
 				})
 			}
 		}()
@@ -107,3 +307,31 @@ func RecoveryMiddleware(logger *slog.Logger) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// captureStack formats up to maxFrames call frames as "func@file:line".
+// skip is passed to runtime.Callers unchanged: 0 is runtime.Callers
+// itself, 1 is captureStack, 2 is captureStack's caller.
+func captureStack(skip, maxFrames int) []string {
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(skip, pcs)
+
+	frames := runtime.CallersFrames(pcs[:n])
+	lines := make([]string, 0, n)
+	for {
+		frame, more := frames.Next()
+		lines = append(lines, fmt.Sprintf("%s@%s:%d", frame.Function, frame.File, frame.Line))
+		if !more {
+			break
+		}
+	}
+	return lines
+}
+
+// panicError normalizes a recover() value into an error for
+// ErrorReporter, which expects one.
+func panicError(rec any) error {
+	if err, ok := rec.(error); ok {
+		return err
+	}
+	return fmt.Errorf("panic: %v", rec)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	r.Use(AuthMiddleware())
+	return r
+}
+
+func TestRequestIDMiddlewareGeneratesAndEchoesID(t *testing.T) {
+	r := newTestRouter()
+	r.GET("/ping", func(c *gin.Context) {
+		c.JSON(200, gin.H{"request_id": GetRequestID(c)})
+	})
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	headerID := w.Header().Get(requestIDHeader)
+	if headerID == "" {
+		t.Fatal("expected X-Request-ID response header to be set")
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if body["request_id"] != headerID {
+		t.Errorf("expected handler-observed request_id %q to match response header %q", body["request_id"], headerID)
+	}
+}
+
+func TestRequestIDMiddlewareHonorsInboundID(t *testing.T) {
+	r := newTestRouter()
+	r.GET("/ping", func(c *gin.Context) {
+		c.Status(200)
+	})
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set(requestIDHeader, "caller-supplied-id")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get(requestIDHeader); got != "caller-supplied-id" {
+		t.Errorf("expected inbound request ID to be echoed back, got %q", got)
+	}
+}
+
+func TestRequireCapRejectsUnauthenticatedWithRequestID(t *testing.T) {
+	r := newTestRouter()
+	r.GET("/protected", RequireCap("query:read"), func(c *gin.Context) {
+		c.Status(200)
+	})
+
+	req := httptest.NewRequest("GET", "/protected", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if body["request_id"] != w.Header().Get(requestIDHeader) {
+		t.Errorf("expected error response to carry the same request_id as the response header")
+	}
+}
+
+func TestReadOnlyMiddlewareBlocksWritesExceptWhitelist(t *testing.T) {
+	SetReadOnly(true)
+	defer SetReadOnly(false)
+
+	r := newTestRouter()
+	r.Use(ReadOnlyMiddleware())
+	r.POST("/urls", func(c *gin.Context) { c.Status(200) })
+	r.GET("/healthz", func(c *gin.Context) { c.Status(200) })
+
+	req := httptest.NewRequest("POST", "/urls", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected writes to be rejected in read-only mode, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/healthz", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected whitelisted path to remain reachable in read-only mode, got %d", w.Code)
+	}
+}
@@ -1,11 +1,9 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"log/slog"
 	"os"
@@ -18,6 +16,105 @@ import (
 
 // Registration directory monitoring functions
 
+// rejectedSubdir is the name of the subdirectory (relative to the
+// configured registration directory) that failed drop files are moved
+// into, alongside a ".error" sidecar explaining why.
+const rejectedSubdir = "rejected"
+
+// registrationEnvelope is the modern on-disk format for a registration
+// drop file: the OTP batch plus a checksum of its own JSON encoding, so
+// automated writers (CI pipelines, orchestration systems) can have
+// their batch verified before BEM trusts it. A bare JSON array of OTPs
+// is still accepted, provided a sidecar "<file>.sha256" sits next to it.
+type registrationEnvelope struct {
+	Checksum string          `json:"checksum"`
+	OTPs     json.RawMessage `json:"otps"`
+}
+
+// loadRegistrationBatch parses a registration drop file's contents and
+// verifies its checksum before returning the OTPs it contains. It tries
+// the envelope format first (a "checksum" field covering the "otps"
+// field's raw bytes), then falls back to a bare JSON array validated
+// against a "<filename>.sha256" sidecar. Either form failing to verify
+// is an error, not a silent pass-through.
+func loadRegistrationBatch(filename string, data []byte) ([]RegistrationOTP, error) {
+	var envelope registrationEnvelope
+	if err := json.Unmarshal(data, &envelope); err == nil && envelope.Checksum != "" && len(envelope.OTPs) > 0 {
+		sum := sha256.Sum256(envelope.OTPs)
+		got := hex.EncodeToString(sum[:])
+		if !strings.EqualFold(got, strings.TrimSpace(envelope.Checksum)) {
+			return nil, fmt.Errorf("checksum mismatch: envelope declares %q, computed %q", envelope.Checksum, got)
+		}
+
+		var otps []RegistrationOTP
+		if err := json.Unmarshal(envelope.OTPs, &otps); err != nil {
+			return nil, fmt.Errorf("parsing envelope otps field: %w", err)
+		}
+		return otps, nil
+	}
+
+	sidecar := filename + ".sha256"
+	want, err := os.ReadFile(sidecar)
+	if err != nil {
+		return nil, fmt.Errorf("no checksum envelope and no %s sidecar: %w", filepath.Base(sidecar), err)
+	}
+
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(got, strings.TrimSpace(strings.Fields(string(want))[0])) {
+		return nil, fmt.Errorf("checksum mismatch: %s declares %q, computed %q", filepath.Base(sidecar), strings.TrimSpace(string(want)), got)
+	}
+
+	var otps []RegistrationOTP
+	if err := json.Unmarshal(data, &otps); err != nil {
+		return nil, fmt.Errorf("parsing registration batch: %w", err)
+	}
+	return otps, nil
+}
+
+// rollbackRegistrationBatch deletes OTPs already written to the store
+// by a batch that failed partway through, so processRegistrationFile
+// can reject the whole file without leaving a partial batch applied.
+// Any individual delete failure is logged but doesn't stop the rest -
+// the caller is already on the error path and has no fallback of its
+// own to retry these.
+func rollbackRegistrationBatch(committed []RegistrationOTP) {
+	for _, otp := range committed {
+		if err := store.DeleteOTP(otp.ClientName, otp.OneTimeKey); err != nil {
+			slog.Error("Could not roll back OTP from a failed registration batch",
+				"client_name", otp.ClientName, "error", err)
+			continue
+		}
+		slog.Warn("Rolled back OTP from a failed registration batch", "client_name", otp.ClientName)
+	}
+}
+
+// rejectRegistrationFile moves a drop file that failed validation into
+// a "rejected" subdirectory alongside a ".error" sidecar explaining
+// why, instead of leaving it for the watcher to retry forever or
+// silently deleting it.
+func rejectRegistrationFile(filename string, cause error) {
+	dir := filepath.Join(filepath.Dir(filename), rejectedSubdir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		slog.Error("Could not create rejected registration directory", "directory", dir, "error", err)
+		return
+	}
+
+	dest := filepath.Join(dir, filepath.Base(filename))
+	if err := os.Rename(filename, dest); err != nil {
+		slog.Error("Could not move rejected registration file", "filename", filename, "error", err)
+		return
+	}
+	os.Remove(filename + ".sha256")
+
+	reason := fmt.Sprintf("%s: rejected at %s: %v\n", filepath.Base(filename), time.Now().Format(time.RFC3339), cause)
+	if err := os.WriteFile(dest+".error", []byte(reason), 0600); err != nil {
+		slog.Error("Could not write rejection reason", "filename", dest+".error", "error", err)
+	}
+
+	slog.Error("Rejected registration file", "filename", filename, "reason", cause)
+}
+
 func processRegistrationFile(filename string) {
 	slog.Info("Processing registration file", "filename", filename)
 
@@ -28,30 +125,44 @@ func processRegistrationFile(filename string) {
 		return
 	}
 
-	// Parse JSON array of registration OTPs
-	var newOTPs []RegistrationOTP
-	if err := json.Unmarshal(data, &newOTPs); err != nil {
-		slog.Error("Error parsing registration file", "filename", filename, "error", err)
+	newOTPs, err := loadRegistrationBatch(filename, data)
+	if err != nil {
+		rejectRegistrationFile(filename, err)
 		return
 	}
 
-	// Add CreatedAt timestamp to new OTPs
+	// Add CreatedAt timestamp to new OTPs, and validate KeyAlgorithm:
+	// an unknown value is replaced by "rsa". An omitted value stays
+	// empty and is resolved at registration time from
+	// Config.ClientKeyAlgorithm ("rsa" when that is unset too).
 	now := time.Now()
 	for i := range newOTPs {
 		newOTPs[i].CreatedAt = now
+		if !validKeyAlgorithms[newOTPs[i].KeyAlgorithm] {
+			slog.Warn("Unknown key_algorithm in registration OTP, defaulting to rsa",
+				"client_name", newOTPs[i].ClientName, "key_algorithm", newOTPs[i].KeyAlgorithm)
+			newOTPs[i].KeyAlgorithm = "rsa"
+		}
 	}
 
-	// Add to our slice and save
-	registrationMutex.Lock()
-	registrationOTPs = append(registrationOTPs, newOTPs...)
-	registrationMutex.Unlock()
-
-	if err := saveRegistrationOTPs(); err != nil {
-		slog.Error("Error saving registration OTPs", "error", err)
-		return
+	// Committed tracks OTPs already written to the store, so a failure
+	// partway through the batch can be rolled back instead of leaving
+	// some of the batch applied while the whole file is moved to
+	// rejected/ - which would otherwise tell an operator "none of this
+	// took effect" when some of it did.
+	committed := make([]RegistrationOTP, 0, len(newOTPs))
+	for _, otp := range newOTPs {
+		if err := store.PutOTP(otpToStore(otp)); err != nil {
+			rollbackRegistrationBatch(committed)
+			rejectRegistrationFile(filename, fmt.Errorf("saving OTP for %s: %w (already-committed OTPs in this batch were rolled back)", otp.ClientName, err))
+			return
+		}
+		committed = append(committed, otp)
+		publishEvent(RegistrationEvent{Type: EventOTPCreated, ClientName: otp.ClientName, OneTimeKey: otp.OneTimeKey})
 	}
 
-	// Remove the processed file
+	// Remove the processed file (and any sidecar checksum alongside it).
+	os.Remove(filename + ".sha256")
 	if err := os.Remove(filename); err != nil {
 		slog.Warn("Could not remove processed registration file", "filename", filename, "error", err)
 	} else {
@@ -107,23 +218,27 @@ func watchRegistrationDirectory(dir string) {
 	// Start monitoring goroutine - this now runs indefinitely
 	go func() {
 		defer watcher.Close() // Close watcher when goroutine exits
-		
+
 		for {
 			select {
 			case event, ok := <-watcher.Events:
 				if !ok {
 					return
 				}
-				
-				// Only process JSON files that are created or written
-				if (event.Op&fsnotify.Create == fsnotify.Create || event.Op&fsnotify.Write == fsnotify.Write) &&
+
+				// Writers are expected to stage the batch under a
+				// ".json.tmp" name and rename it to ".json" once the
+				// write is complete; fsnotify reports the destination
+				// of an in-directory rename as a Create event on the
+				// new name, so that's the only event worth acting on.
+				// In-place Write events on a ".json" file are ignored
+				// entirely - racing those with a fixed sleep was
+				// exactly the bug this replaces.
+				if event.Op&fsnotify.Create == fsnotify.Create &&
 					strings.HasSuffix(strings.ToLower(event.Name), ".json") {
-					
-					// Small delay to ensure file write is complete
-					time.Sleep(100 * time.Millisecond)
 					processRegistrationFile(event.Name)
 				}
-				
+
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
@@ -137,83 +252,68 @@ func watchRegistrationDirectory(dir string) {
 // Client registration and authentication functions
 
 func isClientRegistered(clientName string) bool {
-	registrationMutex.RLock()
-	defer registrationMutex.RUnlock()
-	
-	for _, client := range registeredClients {
-		if client.ClientName == clientName {
-			// Check if expired
-			if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
-				return false // Expired
-			}
-			return true
-		}
+	registered, err := store.IsClientRegistered(clientName)
+	if err != nil {
+		slog.Error("Error checking client registration", "client_name", clientName, "error", err)
+		return false
 	}
-	return false
+	return registered
 }
 
 func findAndRemoveOTP(clientName, oneTimeKey string) (*RegistrationOTP, bool) {
-	registrationMutex.Lock()
-	defer registrationMutex.Unlock()
-	
-	for i, otp := range registrationOTPs {
-		if otp.ClientName == clientName && otp.OneTimeKey == oneTimeKey {
-			// Remove from slice
-			registrationOTPs = append(registrationOTPs[:i], registrationOTPs[i+1:]...)
-			return &otp, true
-		}
+	otp, err := store.GetOTPByKey(oneTimeKey)
+	if err != nil || otp.ClientName != clientName {
+		return nil, false
+	}
+	if err := store.DeleteOTP(clientName, oneTimeKey); err != nil {
+		slog.Error("Error deleting consumed OTP", "client_name", clientName, "error", err)
+		return nil, false
 	}
-	return nil, false
+	publishEvent(RegistrationEvent{Type: EventOTPConsumed, ClientName: clientName, OneTimeKey: oneTimeKey})
+	converted := otpFromStore(otp)
+	return &converted, true
 }
 
 func findAndRemoveOTPByKey(oneTimeKey string) (*RegistrationOTP, bool) {
-	registrationMutex.Lock()
-	defer registrationMutex.Unlock()
-	
-	for i, otp := range registrationOTPs {
-		if otp.OneTimeKey == oneTimeKey {
-			// Remove from slice
-			registrationOTPs = append(registrationOTPs[:i], registrationOTPs[i+1:]...)
-			return &otp, true
-		}
+	otp, err := store.GetOTPByKey(oneTimeKey)
+	if err != nil {
+		return nil, false
+	}
+	if err := store.DeleteOTP(otp.ClientName, oneTimeKey); err != nil {
+		slog.Error("Error deleting consumed OTP", "client_name", otp.ClientName, "error", err)
+		return nil, false
 	}
-	return nil, false
+	publishEvent(RegistrationEvent{Type: EventOTPConsumed, ClientName: otp.ClientName, OneTimeKey: oneTimeKey})
+	converted := otpFromStore(otp)
+	return &converted, true
 }
 
-func generateAndRegisterClient(otp RegistrationOTP, keySize int) (*RegisterResponse, error) {
-	// Generate RSA key pair
-	privateKey, err := rsa.GenerateKey(rand.Reader, keySize)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate RSA key: %v", err)
-	}
-	
-	// Encode private key as PEM for client
-	privateKeyPEM := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}
-	privateKeyBytes := pem.EncodeToMemory(privateKeyPEM)
-	
-	// Encode public key as PEM for storage
-	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal public key: %v", err)
+func generateAndRegisterClient(otp RegistrationOTP, defaultAlgorithm string, keySize int, requestedCapabilities []string, vanityTimeout time.Duration) (*RegisterResponse, error) {
+	algorithm := otp.KeyAlgorithm
+	if algorithm == "" {
+		algorithm = defaultAlgorithm
+	}
+
+	var privateKeyPEM, publicKeyString string
+	var err error
+	if otp.FingerprintPrefix != "" {
+		privateKeyPEM, publicKeyString, err = findVanityKeyPair(algorithm, keySize, otp.FingerprintPrefix, vanityTimeout)
+	} else {
+		privateKeyPEM, publicKeyString, err = generateClientKeyPair(algorithm, keySize)
 	}
-	
-	publicKeyPEM := &pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: publicKeyBytes,
+	if err != nil {
+		return nil, err
 	}
-	publicKeyString := string(pem.EncodeToMemory(publicKeyPEM))
-	
+
 	// Calculate expiration date
 	var expiresAt *time.Time
 	if otp.KeyLifespanDays > 0 {
 		expiry := time.Now().AddDate(0, 0, otp.KeyLifespanDays)
 		expiresAt = &expiry
 	}
-	
-	// Create registered client record
+
+	// Create registered client record, stamping it with the intersection
+	// of the parent OTP's capabilities and any narrower set requested.
 	client := RegisteredClient{
 		ClientName:      otp.ClientName,
 		PublicKey:       publicKeyString,
@@ -221,26 +321,17 @@ func generateAndRegisterClient(otp RegistrationOTP, keySize int) (*RegisterRespo
 		ExpiresAt:       expiresAt,
 		LastUsed:        time.Now(),
 		KeyLifespanDays: otp.KeyLifespanDays,
+		Capabilities:    intersectCapabilities(otp.Capabilities, requestedCapabilities),
 	}
-	
-	// Add to registered clients slice
-	registrationMutex.Lock()
-	registeredClients = append(registeredClients, client)
-	registrationMutex.Unlock()
-	
-	// Save to disk
-	if err := saveRegisteredClients(); err != nil {
-		return nil, fmt.Errorf("failed to save registered clients: %v", err)
-	}
-	
-	// Save updated OTPs (with the used one removed)
-	if err := saveRegistrationOTPs(); err != nil {
-		return nil, fmt.Errorf("failed to save registration OTPs: %v", err)
-	}
-	
+
+	if err := store.PutClient(clientToStore(client)); err != nil {
+		return nil, fmt.Errorf("failed to save registered client: %v", err)
+	}
+	publishEvent(RegistrationEvent{Type: EventClientRegistered, ClientName: client.ClientName})
+
 	return &RegisterResponse{
 		Success:    true,
-		PrivateKey: string(privateKeyBytes),
+		PrivateKey: privateKeyPEM,
 		Message:    "Client registered successfully",
 	}, nil
-}
\ No newline at end of file
+}
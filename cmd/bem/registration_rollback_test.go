@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bemstore"
+)
+
+// failNthPutStore wraps a real FileStore but fails the failAt'th call to
+// PutOTP, so processRegistrationFile's rollback path can be exercised
+// without a fake implementing every bemstore.Storage method.
+type failNthPutStore struct {
+	*bemstore.FileStore
+	putCalls int
+	failAt   int
+}
+
+func (s *failNthPutStore) PutOTP(otp bemstore.OTP) error {
+	s.putCalls++
+	if s.putCalls == s.failAt {
+		return fmt.Errorf("simulated storage failure")
+	}
+	return s.FileStore.PutOTP(otp)
+}
+
+func TestProcessRegistrationFileRollsBackPartialBatchOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := bemstore.NewFileStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer fileStore.Close()
+
+	origStore := store
+	store = &failNthPutStore{FileStore: fileStore, failAt: 3}
+	defer func() { store = origStore }()
+
+	batch := []RegistrationOTP{
+		{ClientName: "alice", OneTimeKey: "key-alice"},
+		{ClientName: "bob", OneTimeKey: "key-bob"},
+		{ClientName: "carol", OneTimeKey: "key-carol"},
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatalf("marshaling batch: %v", err)
+	}
+
+	batchPath := filepath.Join(dir, "batch.json")
+	if err := os.WriteFile(batchPath, data, 0600); err != nil {
+		t.Fatalf("writing batch file: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if err := os.WriteFile(batchPath+".sha256", []byte(hex.EncodeToString(sum[:])), 0600); err != nil {
+		t.Fatalf("writing sidecar: %v", err)
+	}
+
+	processRegistrationFile(batchPath)
+
+	otps, err := fileStore.ListOTPs()
+	if err != nil {
+		t.Fatalf("ListOTPs: %v", err)
+	}
+	if len(otps) != 0 {
+		t.Errorf("expected the failed batch's earlier OTPs (alice, bob) to be rolled back, found %d left: %+v", len(otps), otps)
+	}
+
+	rejectedPath := filepath.Join(dir, rejectedSubdir, "batch.json")
+	if _, err := os.Stat(rejectedPath); err != nil {
+		t.Errorf("expected the batch file to be moved to %s: %v", rejectedPath, err)
+	}
+}
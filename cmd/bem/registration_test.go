@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRegistrationBatchEnvelope(t *testing.T) {
+	otps := `[{"client_name":"alice","one_time_key":"key1"}]`
+	sum := sha256.Sum256([]byte(otps))
+	validChecksum := hex.EncodeToString(sum[:])
+
+	cases := []struct {
+		name    string
+		data    string
+		wantErr bool
+		wantLen int
+	}{
+		{
+			name:    "valid checksum",
+			data:    fmt.Sprintf(`{"checksum":%q,"otps":%s}`, validChecksum, otps),
+			wantErr: false,
+			wantLen: 1,
+		},
+		{
+			name:    "checksum mismatch",
+			data:    fmt.Sprintf(`{"checksum":"%s","otps":%s}`, "deadbeef", otps),
+			wantErr: true,
+		},
+		{
+			name:    "checksum is case-insensitive",
+			data:    fmt.Sprintf(`{"checksum":%q,"otps":%s}`, upper(validChecksum), otps),
+			wantErr: false,
+			wantLen: 1,
+		},
+		{
+			name:    "checksum has surrounding whitespace",
+			data:    fmt.Sprintf(`{"checksum":%q,"otps":%s}`, "  "+validChecksum+"\n", otps),
+			wantErr: false,
+			wantLen: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := loadRegistrationBatch("batch.json", []byte(tc.data))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != tc.wantLen {
+				t.Errorf("expected %d OTPs, got %d", tc.wantLen, len(got))
+			}
+		})
+	}
+}
+
+func TestLoadRegistrationBatchSidecar(t *testing.T) {
+	otps := `[{"client_name":"bob","one_time_key":"key2"}]`
+	sum := sha256.Sum256([]byte(otps))
+	validChecksum := hex.EncodeToString(sum[:])
+
+	cases := []struct {
+		name        string
+		sidecar     string
+		sidecarHave bool
+		wantErr     bool
+	}{
+		{
+			name:        "valid sidecar",
+			sidecar:     validChecksum,
+			sidecarHave: true,
+			wantErr:     false,
+		},
+		{
+			name:        "sidecar with trailing filename (sha256sum format)",
+			sidecar:     validChecksum + "  batch.json\n",
+			sidecarHave: true,
+			wantErr:     false,
+		},
+		{
+			name:        "sidecar checksum mismatch",
+			sidecar:     "deadbeef",
+			sidecarHave: true,
+			wantErr:     true,
+		},
+		{
+			name:        "missing sidecar",
+			sidecarHave: false,
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			batchPath := filepath.Join(dir, "batch.json")
+			if err := os.WriteFile(batchPath, []byte(otps), 0600); err != nil {
+				t.Fatalf("writing batch file: %v", err)
+			}
+			if tc.sidecarHave {
+				if err := os.WriteFile(batchPath+".sha256", []byte(tc.sidecar), 0600); err != nil {
+					t.Fatalf("writing sidecar file: %v", err)
+				}
+			}
+
+			got, err := loadRegistrationBatch(batchPath, []byte(otps))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != 1 || got[0].ClientName != "bob" {
+				t.Errorf("expected a single OTP for bob, got %+v", got)
+			}
+		})
+	}
+}
+
+func upper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'f' {
+			b[i] = c - ('a' - 'A')
+		}
+	}
+	return string(b)
+}
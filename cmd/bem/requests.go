@@ -97,7 +97,9 @@ func createRegistrationRequestFile(clientName, requestsDir string) (string, erro
 }
 
 // HTTP handler for registration requests
-func handleRegistrationRequest(c *gin.Context, config Config) {
+func handleRegistrationRequest(c *gin.Context) {
+	config := c.MustGet("config").(Config)
+
 	clientName := c.Query("ClientName")
 	if clientName == "" {
 		c.JSON(400, RegistrationRequestResponse{
@@ -2,13 +2,131 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
+	"os"
 	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest"
 )
 
+// pinnedCipherSuites is the cipher suite list used for both the
+// static-certificate and automatic-TLS (ACME) code paths.
+var pinnedCipherSuites = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_AES_128_GCM_SHA256,
+	tls.TLS_AES_256_GCM_SHA384,
+	tls.TLS_CHACHA20_POLY1305_SHA256,
+}
+
+// AutoTLSOptions configures automatic certificate issuance/renewal via
+// ACME (e.g. Let's Encrypt) instead of a static CertPath/KeyPath pair.
+type AutoTLSOptions struct {
+	Domains  []string // HostWhitelist: only these names are issued certs
+	Email    string   // contact address for the ACME account
+	CacheDir string   // directory for autocert.DirCache to persist certs
+}
+
+// buildServerTLSOptions reads the PEM files referenced by a BigFixServer
+// config entry into a bfrest.TLSOptions. A server with no CA/client-cert
+// fields set gets a nil-equivalent TLSOptions (system roots, no client
+// cert), matching pre-mTLS behavior except that certificates are now
+// actually verified unless Insecure is set.
+func buildServerTLSOptions(server BigFixServer) (*bfrest.TLSOptions, error) {
+	opts := &bfrest.TLSOptions{Insecure: server.Insecure}
+
+	if server.CAFile != "" {
+		ca, err := os.ReadFile(server.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		opts.CABundle = ca
+	}
+
+	if server.ClientCertFile != "" || server.ClientKeyFile != "" {
+		cert, err := os.ReadFile(server.ClientCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client_cert_file: %w", err)
+		}
+		key, err := os.ReadFile(server.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client_key_file: %w", err)
+		}
+		opts.ClientCert = cert
+		opts.ClientKey = key
+	}
+
+	return opts, nil
+}
+
+// backendConfigFrom translates Config.CacheBackend into the
+// bfrest.BackendConfig expected by AddServerWithBackend, shared by
+// main's startup loop and the runtime POST /admin/servers handler.
+func backendConfigFrom(config Config) bfrest.BackendConfig {
+	return bfrest.BackendConfig{
+		Driver:        config.CacheBackend.Driver,
+		FSDir:         config.CacheBackend.FSDir,
+		RedisAddr:     config.CacheBackend.RedisAddr,
+		RedisPassword: config.CacheBackend.RedisPassword,
+		RedisDB:       config.CacheBackend.RedisDB,
+		BadgerDir:     config.CacheBackend.BadgerDir,
+	}
+}
+
+// addServerToCache wires a single BigFixServer config entry into cache:
+// builds its TLS options, adds the pooled connection and CacheMap via
+// AddServerWithBackend, then applies any per-server overrides (zero
+// values are left alone, inheriting the cache-wide default). Used both
+// at startup (main's server loop) and by the runtime POST
+// /admin/servers handler, so the two stay in sync.
+func addServerToCache(cache *bfrest.BigFixCache, server BigFixServer, backendCfg bfrest.BackendConfig) error {
+	tlsOpts, err := buildServerTLSOptions(server)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS options: %w", err)
+	}
+
+	if _, err := cache.AddServerWithBackend(server.URL, server.Username, server.Password, server.PoolSize, server.MaxAge, tlsOpts, backendCfg); err != nil {
+		return err
+	}
+
+	if server.MaxPayloadSize != 0 {
+		if err := cache.SetMaxPayloadSize(server.URL, server.MaxPayloadSize); err != nil {
+			return err
+		}
+	}
+	if server.StaleWhileRevalidate != 0 {
+		if err := cache.SetStaleWhileRevalidate(server.URL, server.StaleWhileRevalidate); err != nil {
+			return err
+		}
+	}
+	if server.StaleIfError != 0 {
+		if err := cache.SetStaleIfError(server.URL, server.StaleIfError); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MTLSOptions configures mutual TLS for the admin/registration API. A
+// mobile client presenting a certificate signed by a trusted CA has its
+// certificate's CN used as its presumed ClientName by the registration
+// handler, see PeerCertificateCN.
+type MTLSOptions struct {
+	ClientCAPath      string // PEM file with CA(s) allowed to sign client certs
+	RequireClientCert bool   // reject the handshake if no client cert is presented
+}
+
 // TLSListener wraps a net.Listener to log TLS connection details and errors
 type TLSListener struct {
 	net.Listener
@@ -37,8 +155,8 @@ func (l *TLSListener) Accept() (net.Conn, error) {
 // loggingConn wraps net.Conn to log TLS handshake details
 type loggingConn struct {
 	net.Conn
-	logger      *slog.Logger
-	remote      string
+	logger        *slog.Logger
+	remote        string
 	handshakeDone bool
 }
 
@@ -90,27 +208,71 @@ func tlsVersionString(version uint16) string {
 	}
 }
 
-// StartTLSServer starts the HTTP server with TLS and comprehensive logging
-func StartTLSServer(handler http.Handler, certPath, keyPath string, port int, logger *slog.Logger) error {
-	// Load TLS certificate
-	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
-	if err != nil {
-		return fmt.Errorf("failed to load TLS certificate: %w", err)
+// StartTLSServer starts the HTTP server with TLS and comprehensive logging.
+// mtls may be nil, in which case the server accepts plain one-way TLS as
+// before; otherwise it verifies client certificates against ClientCAPath.
+// autoTLS may be nil (the default, static certPath/keyPath are loaded);
+// when set, certificates are issued and renewed automatically via ACME
+// and certPath/keyPath are ignored.
+func StartTLSServer(handler http.Handler, certPath, keyPath string, port int, logger *slog.Logger, mtls *MTLSOptions, autoTLS *AutoTLSOptions) error {
+	var tlsConfig *tls.Config
+
+	if autoTLS != nil {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(autoTLS.Domains...),
+			Cache:      autocert.DirCache(autoTLS.CacheDir),
+			Email:      autoTLS.Email,
+		}
+
+		tlsConfig = manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		tlsConfig.CipherSuites = pinnedCipherSuites
+
+		// The HTTP-01 challenge requires a plain-HTTP listener on :80;
+		// run it alongside the HTTPS server so renewal needs no operator
+		// intervention.
+		go func() {
+			if err := http.ListenAndServe(":80", manager.HTTPHandler(nil)); err != nil {
+				logger.Error("ACME HTTP-01 challenge listener failed", "error", err)
+			}
+		}()
+
+		logger.Info("Automatic TLS (ACME) enabled", "domains", autoTLS.Domains)
+	} else {
+		// Load TLS certificate
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+
+		tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+			CipherSuites: pinnedCipherSuites,
+		}
 	}
 
-	// Configure TLS
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
-			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_AES_128_GCM_SHA256,
-			tls.TLS_AES_256_GCM_SHA384,
-			tls.TLS_CHACHA20_POLY1305_SHA256,
-		},
+	if mtls != nil && mtls.ClientCAPath != "" {
+		caBytes, err := os.ReadFile(mtls.ClientCAPath)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return fmt.Errorf("failed to parse client CA bundle")
+		}
+		tlsConfig.ClientCAs = pool
+
+		if mtls.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		logger.Info("Client certificate verification enabled for admin API",
+			"require_client_cert", mtls.RequireClientCert)
 	}
 
 	// Create base listener
@@ -146,3 +308,32 @@ func StartTLSServer(handler http.Handler, certPath, keyPath string, port int, lo
 	// Serve with custom listener
 	return server.Serve(loggingListener)
 }
+
+// StartQUICServer serves handler over HTTP/3 (QUIC) on quicPort, reusing
+// the same X.509 keypair as the TCP+TLS listener started by
+// StartTLSServer. Mobile clients on lossy cellular networks benefit from
+// QUIC's 0-RTT resumption and connection migration; AltSvcMiddleware
+// advertises this listener so clients know to upgrade.
+func StartQUICServer(handler http.Handler, certPath, keyPath string, quicPort int, logger *slog.Logger) error {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h3"},
+	}
+
+	server := &http3.Server{
+		Addr:      fmt.Sprintf(":%d", quicPort),
+		Port:      quicPort,
+		TLSConfig: tlsConfig,
+		Handler:   handler,
+	}
+
+	logger.Info("Starting QUIC/HTTP3 server", "port", quicPort)
+
+	return server.ListenAndServe()
+}
@@ -1,172 +1,105 @@
 package main
 
 import (
-	"crypto/x509"
-	"encoding/json"
-	"encoding/pem"
 	"fmt"
-	"log/slog"
-	"os"
 	"path/filepath"
-	"time"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bemstore"
 )
 
-// Storage functions for persistent client registration data
+// newStorage builds the bemstore.Storage driver selected by
+// config.Storage.Driver. An empty/"file" driver preserves the historical
+// behavior of JSON files under registrationDataDir.
+func newStorage(config Config) (bemstore.Storage, error) {
+	switch config.Storage.Driver {
+	case "", "file":
+		return bemstore.NewFileStore(registrationDataDir)
 
-func createBackup(filename string) error {
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return nil // No file to backup
-	}
-	
-	// Find next backup number
-	backupNum := 1
-	for {
-		backupName := fmt.Sprintf("%s.bak.%d", filename, backupNum)
-		if _, err := os.Stat(backupName); os.IsNotExist(err) {
-			return os.Rename(filename, backupName)
+	case "bolt":
+		path := config.Storage.BoltPath
+		if path == "" {
+			path = filepath.Join(registrationDataDir, "bem.bolt")
 		}
-		backupNum++
-	}
-}
+		return bemstore.NewBoltStore(path)
 
-func saveRegistrationOTPs() error {
-	registrationMutex.Lock()
-	defer registrationMutex.Unlock()
-	
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(registrationDataDir, 0700); err != nil {
-		return fmt.Errorf("failed to create registration data directory: %v", err)
-	}
-	
-	filename := filepath.Join(registrationDataDir, "registration_otps.json")
-	
-	// Create backup
-	if err := createBackup(filename); err != nil {
-		slog.Warn("Could not create backup", "filename", filename, "error", err)
-	}
-	
-	// Write to temporary file first, then rename (atomic operation)
-	tmpFile := filename + ".tmp"
-	data, err := json.MarshalIndent(registrationOTPs, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal registration OTPs: %v", err)
-	}
-	
-	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
-		return fmt.Errorf("failed to write registration OTPs: %v", err)
-	}
-	
-	return os.Rename(tmpFile, filename)
-}
+	case "etcd":
+		if len(config.Storage.EtcdEndpoints) == 0 {
+			return nil, fmt.Errorf("storage.etcd_endpoints must be set when storage.driver is \"etcd\"")
+		}
+		prefix := config.Storage.EtcdPrefix
+		if prefix == "" {
+			prefix = "/bem/"
+		}
+		return bemstore.NewEtcdStore(prefix, bemstore.EtcdOptions{
+			Endpoints: config.Storage.EtcdEndpoints,
+			Username:  config.Storage.EtcdUsername,
+			Password:  config.Storage.EtcdPassword,
+		})
 
-func loadRegistrationOTPs() error {
-	filename := filepath.Join(registrationDataDir, "registration_otps.json")
-	
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		registrationOTPs = make([]RegistrationOTP, 0)
-		return nil // File doesn't exist yet, start with empty slice
-	}
-	
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read registration OTPs: %v", err)
-	}
-	
-	registrationMutex.Lock()
-	defer registrationMutex.Unlock()
-	
-	if err := json.Unmarshal(data, &registrationOTPs); err != nil {
-		return fmt.Errorf("failed to parse registration OTPs: %v", err)
+	default:
+		return nil, fmt.Errorf("unknown storage.driver %q (want \"file\", \"bolt\", or \"etcd\")", config.Storage.Driver)
 	}
-	
-	return nil
 }
 
-// saveRegisteredClientsUnlocked saves without acquiring mutex (caller must hold lock)
-func saveRegisteredClientsUnlocked() error {
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(registrationDataDir, 0700); err != nil {
-		return fmt.Errorf("failed to create registration data directory: %v", err)
+// otpToStore and otpFromStore convert between the wire-format
+// RegistrationOTP (used by drop files and the registration directory
+// watcher) and bemstore.OTP (the persisted record).
+func otpToStore(o RegistrationOTP) bemstore.OTP {
+	return bemstore.OTP{
+		ClientName:      o.ClientName,
+		OneTimeKey:      o.OneTimeKey,
+		KeyLifespanDays: o.KeyLifespanDays,
+		CreatedAt:       o.CreatedAt,
+		RequestedBy:     o.RequestedBy,
+		Capabilities:    o.Capabilities,
+		NamePrefix:      o.NamePrefix,
+		ValidDuration:   o.ValidDuration,
+		AllowedCIDRs:    o.AllowedCIDRs,
+		KeyAlgorithm:    o.KeyAlgorithm,
+		Extra:           o.Extra,
 	}
-	
-	filename := filepath.Join(registrationDataDir, "registered_clients.json")
-	
-	// Create backup
-	if err := createBackup(filename); err != nil {
-		slog.Warn("Could not create backup", "filename", filename, "error", err)
-	}
-	
-	// Marshal to JSON
-	data, err := json.MarshalIndent(registeredClients, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal registered clients: %v", err)
-	}
-	
-	// Write to file with restricted permissions
-	if err := os.WriteFile(filename, data, 0600); err != nil {
-		return fmt.Errorf("failed to write registered clients file: %v", err)
-	}
-	
-	return nil
 }
 
-func saveRegisteredClients() error {
-	registrationMutex.Lock()
-	defer registrationMutex.Unlock()
-	
-	return saveRegisteredClientsUnlocked()
+func otpFromStore(o bemstore.OTP) RegistrationOTP {
+	return RegistrationOTP{
+		ClientName:      o.ClientName,
+		OneTimeKey:      o.OneTimeKey,
+		KeyLifespanDays: o.KeyLifespanDays,
+		CreatedAt:       o.CreatedAt,
+		RequestedBy:     o.RequestedBy,
+		Capabilities:    o.Capabilities,
+		NamePrefix:      o.NamePrefix,
+		ValidDuration:   o.ValidDuration,
+		AllowedCIDRs:    o.AllowedCIDRs,
+		KeyAlgorithm:    o.KeyAlgorithm,
+		Extra:           o.Extra,
+	}
 }
 
-func loadRegisteredClients() error {
-	filename := filepath.Join(registrationDataDir, "registered_clients.json")
-	
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		registeredClients = make([]RegisteredClient, 0)
-		return nil // File doesn't exist yet, start with empty slice
+func clientToStore(c RegisteredClient) bemstore.Client {
+	return bemstore.Client{
+		ClientName:             c.ClientName,
+		PublicKey:              c.PublicKey,
+		RegisteredAt:           c.RegisteredAt,
+		ExpiresAt:              c.ExpiresAt,
+		LastUsed:               c.LastUsed,
+		KeyLifespanDays:        c.KeyLifespanDays,
+		Capabilities:           c.Capabilities,
+		CertificatePEM:         c.CertificatePEM,
+		CertificateFingerprint: c.CertificateFingerprint,
 	}
-	
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read registered clients: %v", err)
-	}
-	
-	registrationMutex.Lock()
-	defer registrationMutex.Unlock()
-	
-	if err := json.Unmarshal(data, &registeredClients); err != nil {
-		return fmt.Errorf("failed to parse registered clients: %v", err)
-	}
-	
-	// Validate public keys and remove expired clients
-	validClients := make([]RegisteredClient, 0)
-	for _, client := range registeredClients {
-		// Validate PEM-encoded public key
-		block, _ := pem.Decode([]byte(client.PublicKey))
-		if block == nil {
-			slog.Warn("Invalid PEM key for client, removing", "client_name", client.ClientName)
-			continue
-		}
-
-		_, err := x509.ParsePKIXPublicKey(block.Bytes)
-		if err != nil {
-			slog.Warn("Invalid public key for client, removing", "client_name", client.ClientName, "error", err)
-			continue
-		}
+}
 
-		// Check if expired
-		if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
-			slog.Info("Expired client removed", "client_name", client.ClientName)
-			continue
-		}
-		
-		validClients = append(validClients, client)
-	}
-	
-	// Update slice and save if any clients were removed
-	if len(validClients) != len(registeredClients) {
-		registeredClients = validClients
-		return saveRegisteredClients() // This will create a backup of the cleaned version
+func clientFromStore(c bemstore.Client) RegisteredClient {
+	return RegisteredClient{
+		ClientName:             c.ClientName,
+		PublicKey:              c.PublicKey,
+		RegisteredAt:           c.RegisteredAt,
+		ExpiresAt:              c.ExpiresAt,
+		LastUsed:               c.LastUsed,
+		KeyLifespanDays:        c.KeyLifespanDays,
+		Capabilities:           c.Capabilities,
+		CertificatePEM:         c.CertificatePEM,
+		CertificateFingerprint: c.CertificateFingerprint,
 	}
-	
-	return nil
-}
\ No newline at end of file
+}
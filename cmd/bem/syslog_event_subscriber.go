@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+)
+
+// rfc5424Facility/rfc5424Severity pick local0/informational for every
+// event line. They are fixed, unlike the application's own "syslog" log
+// sink (see SyslogConfig), whose facility is configurable and defaults
+// to daemon.
+const (
+	rfc5424Facility = 16 // local0
+	rfc5424Severity = 6  // informational
+)
+
+// syslogEventSubscriber sends an RFC 5424-formatted message over the
+// network for every registration lifecycle event. It is independent of
+// the application's "syslog" log sink (SyslogConfig/newSyslogWriter) so
+// event delivery can target a different collector (e.g. a SIEM)
+// without disturbing where application logs go.
+type syslogEventSubscriber struct {
+	network  string
+	address  string
+	appName  string
+	hostname string
+}
+
+// newSyslogEventSubscriber builds a syslogEventSubscriber from config.
+// Callers should only construct one when config.Address is non-empty.
+func newSyslogEventSubscriber(config EventSyslogConfig) (*syslogEventSubscriber, error) {
+	network := config.Network
+	if network == "" {
+		network = "udp"
+	}
+	appName := config.AppName
+	if appName == "" {
+		appName = "bem"
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &syslogEventSubscriber{network: network, address: config.Address, appName: appName, hostname: hostname}, nil
+}
+
+// Handle dials address fresh for each event. UDP dialing is cheap and
+// connectionless; for TCP this trades a per-event reconnect for never
+// holding a socket open across config reloads.
+func (s *syslogEventSubscriber) Handle(event RegistrationEvent) {
+	conn, err := net.Dial(s.network, s.address)
+	if err != nil {
+		slog.Error("Syslog event delivery failed to connect", "address", s.address, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	priority := rfc5424Facility*8 + rfc5424Severity
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - client_name=%q one_time_key=%q\n",
+		priority,
+		event.Time.UTC().Format(time.RFC3339),
+		s.hostname,
+		s.appName,
+		os.Getpid(),
+		event.Type,
+		event.ClientName,
+		event.OneTimeKey,
+	)
+
+	if _, err := conn.Write([]byte(msg)); err != nil {
+		slog.Error("Syslog event delivery failed to write", "address", s.address, "error", err)
+	}
+}
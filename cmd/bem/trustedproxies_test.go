@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestClientIPIgnoresSpoofedHeaderWithNoTrustedProxies guards the fix
+// for AllowedCIDRs (see ipAllowed/auth.go) being bypassable via a
+// forged X-Forwarded-For: with Gin's default trusted-proxies list
+// (trust everything), ClientIP() returns whatever a client puts in that
+// header. main's SetTrustedProxies(config.TrustedProxies) call, with
+// TrustedProxies left unconfigured, must make ClientIP() fall back to
+// the real TCP peer instead.
+func TestClientIPIgnoresSpoofedHeaderWithNoTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := r.SetTrustedProxies(nil); err != nil {
+		t.Fatalf("SetTrustedProxies(nil): %v", err)
+	}
+
+	var observedIP string
+	r.GET("/ping", func(c *gin.Context) {
+		observedIP = c.ClientIP()
+		c.Status(200)
+	})
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.RemoteAddr = "203.0.113.9:54321"
+	req.Header.Set("X-Forwarded-For", "127.0.0.1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if observedIP != "203.0.113.9" {
+		t.Errorf("expected ClientIP() to ignore the spoofed X-Forwarded-For and report the real peer 203.0.113.9, got %q", observedIP)
+	}
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bemstore"
 )
 
 // Application metadata
@@ -12,28 +15,282 @@ var (
 
 // Configuration structures
 type Config struct {
-	AppCacheTimeout          uint64         `json:"app_cache_timeout"`
-	BigFixServers            []BigFixServer `json:"bigfix_servers"`
-	ListenPort               int            `json:"listen_port"`
-	CertPath                 string         `json:"cert_path"`
-	KeyPath                  string         `json:"key_path"`
-	KeySize                  int            `json:"keysize"`
-	RegistrationDir          string         `json:"registration_dir"`
-	RequestsDir              string         `json:"requests_dir"`
-	RegistrationDataDir      string         `json:"registration_data_dir"`
-	GarbageCollectorInterval uint64         `json:"garbage_collector_interval"` // seconds between GC sweeps, default 15
-	MaxCacheLifetime         uint64         `json:"max_cache_lifetime"`          // maximum cache lifetime in seconds, default 86400 (24 hours)
-	Debug                    int            `json:"debug"`                       // DEPRECATED: use log_level instead. 0 = debug logging off, non-zero = debug logging on
+	AppCacheTimeout     uint64         `json:"app_cache_timeout"`
+	BigFixServers       []BigFixServer `json:"bigfix_servers"`
+	ListenPort          int            `json:"listen_port"`
+	CertPath            string         `json:"cert_path"`
+	KeyPath             string         `json:"key_path"`
+	KeySize             int            `json:"keysize"`
+	RegistrationDir     string         `json:"registration_dir"`
+	RequestsDir         string         `json:"requests_dir"`
+	RegistrationDataDir string         `json:"registration_data_dir"`
+
+	// OTPTTLHours bounds how long an outstanding registration OTP may
+	// sit unused before the periodic cleanup sweep (see
+	// cleanupExpiredSessions) deletes it, measured from its CreatedAt.
+	// Defaults to 24 hours when 0; set negative to disable OTP sweeping
+	// entirely.
+	OTPTTLHours              int    `json:"otp_ttl_hours"`
+	GarbageCollectorInterval uint64 `json:"garbage_collector_interval"` // seconds between GC sweeps, default 15
+	MaxCacheLifetime         uint64 `json:"max_cache_lifetime"`         // maximum cache lifetime in seconds, default 86400 (24 hours)
+	Debug                    int    `json:"debug"`                      // DEPRECATED: use log_level instead. 0 = debug logging off, non-zero = debug logging on
 
 	// Logging configuration
-	LogLevel      string `json:"log_level"`         // log level: "DEBUG", "INFO", "WARN", or "ERROR" (default: "INFO", or "DEBUG" if debug=1)
-	LogToFile     bool   `json:"log_to_file"`       // enable file logging
-	LogFilePath   string `json:"log_file_path"`     // path to log file
-	LogMaxSizeMB  int    `json:"log_max_size_mb"`   // maximum size in megabytes before rotation
-	LogMaxBackups int    `json:"log_max_backups"`   // maximum number of old log files to retain
-	LogMaxAgeDays int    `json:"log_max_age_days"`  // maximum number of days to retain old log files
-	LogCompress   bool   `json:"log_compress"`      // compress old log files with gzip
-	LogToConsole  bool   `json:"log_to_console"`    // also log to stdout (in addition to file)
+	LogLevel            string `json:"log_level"`             // log level: "DEBUG", "INFO", "WARN", or "ERROR" (default: "INFO", or "DEBUG" if debug=1)
+	LogFormat           string `json:"log_format"`            // "text" (default) or "json", for log aggregation pipelines (ELK/Loki/Splunk)
+	LogToFile           bool   `json:"log_to_file"`           // enable file logging
+	LogFilePath         string `json:"log_file_path"`         // path to log file
+	LogMaxSizeMB        int    `json:"log_max_size_mb"`       // maximum size in megabytes before rotation
+	LogMaxBackups       int    `json:"log_max_backups"`       // maximum number of old log files to retain
+	LogMaxAgeDays       int    `json:"log_max_age_days"`      // maximum number of days to retain old log files
+	LogCompress         bool   `json:"log_compress"`          // compress old log files with gzip
+	LogToConsole        bool   `json:"log_to_console"`        // also log to stdout (in addition to file)
+	LogRotationInterval string `json:"log_rotation_interval"` // e.g. "24h": force rotation on this cadence regardless of size; "" disables
+
+	// LogSinks selects one or more output destinations: "stdout",
+	// "file", "syslog", "journald", or "eventlog". When empty, the
+	// legacy LogToFile/LogToConsole booleans are used instead. See
+	// buildLogWriter.
+	LogSinks []string     `json:"log_sinks"`
+	Syslog   SyslogConfig `json:"syslog"`
+
+	// EventLogSource names the Windows Event Log source registered for
+	// the "eventlog" sink (default "BigFix Mobile Enterprise").
+	EventLogSource string `json:"event_log_source"`
+
+	// ReadOnly starts the server refusing non-GET requests (except a
+	// small whitelist). It is only the initial value: the effective
+	// state is held in a runtime-toggleable flag, see SetReadOnly.
+	ReadOnly bool `json:"read_only"`
+
+	// Cache tiering: leaving HotEntries/HotBytes at 0 keeps the historical
+	// unbounded in-memory cache. Setting either bounds the hot tier with
+	// an LRU, spilling evicted entries to DiskDir when it is set.
+	// CacheHotBytes is the per-server byte budget (max_cache_bytes_per_server);
+	// CacheMaxTotalBytes additionally caps the sum across every server.
+	CacheHotEntries    int    `json:"cache_hot_entries"`
+	CacheHotBytes      int64  `json:"max_cache_bytes_per_server"`
+	CacheMaxTotalBytes int64  `json:"max_cache_bytes_total"`
+	CacheDiskDir       string `json:"cache_disk_dir"`
+	CacheDiskBytes     int64  `json:"cache_disk_bytes"`
+
+	// CacheBackend selects the persistent store behind each BigFix
+	// server's hot tier (see bfrest.BackendConfig). Leaving Driver empty
+	// keeps the historical in-memory cache.
+	CacheBackend CacheBackendConfig `json:"cache_backend"`
+
+	// CacheMaxPayloadSize caps how large a response body (in bytes) may
+	// be before it's admitted to the cache; 0 = unbounded. Oversized
+	// responses are still served to the caller, just never cached. A
+	// per-server BigFixServer.MaxPayloadSize overrides this default.
+	CacheMaxPayloadSize uint64 `json:"cache_max_payload_size"`
+
+	// CacheStaleWhileRevalidate and CacheStaleIfError configure RFC 5861
+	// semantics (in seconds past a response's MaxAge) for every server;
+	// 0 disables each independently. Per-server BigFixServer fields of
+	// the same name override these defaults.
+	CacheStaleWhileRevalidate uint64 `json:"cache_stale_while_revalidate"`
+	CacheStaleIfError         uint64 `json:"cache_stale_if_error"`
+
+	// MTLSClientCAPath, if set, enables mutual TLS on the admin API: client
+	// certificates are verified against this CA bundle and, when presented,
+	// their CN is used as the presumed ClientName during /register (see
+	// PeerCertificateCN). MTLSRequireClientCert rejects handshakes that
+	// don't present one at all.
+	MTLSClientCAPath      string `json:"mtls_client_ca_path"`
+	MTLSRequireClientCert bool   `json:"mtls_require_client_cert"`
+
+	// AutoTLS switches StartTLSServer to ACME-issued certificates (e.g.
+	// Let's Encrypt) instead of CertPath/KeyPath. AutoTLSDomains must list
+	// every hostname the server answers to; AutoTLSCacheDir persists
+	// issued certificates across restarts.
+	AutoTLS         bool     `json:"auto_tls"`
+	AutoTLSDomains  []string `json:"auto_tls_domains"`
+	AutoTLSEmail    string   `json:"auto_tls_email"`
+	AutoTLSCacheDir string   `json:"auto_tls_cache_dir"`
+
+	// EnableHTTP3 starts a second listener serving the same Gin handler
+	// over QUIC/HTTP/3 (see StartQUICServer), advertised to clients via
+	// an Alt-Svc response header. QUICPort defaults to ListenPort when 0.
+	EnableHTTP3 bool `json:"enable_http3"`
+	QUICPort    int  `json:"quic_port"`
+
+	// TrustedProxies lists the IPs/CIDRs of reverse proxies allowed to
+	// set X-Forwarded-For/X-Real-IP, passed straight to Gin's
+	// SetTrustedProxies. Left empty (the default), Gin trusts no proxy
+	// and Context.ClientIP() returns the direct TCP peer address - this
+	// must stay the default since nothing else in this server terminates
+	// a reverse proxy, and RegistrationOTP.AllowedCIDRs (see ipAllowed)
+	// depends on ClientIP() reflecting the real remote address rather
+	// than a header any client can set.
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// Storage selects and configures the persistence backend for
+	// registration OTPs, registered clients, and admin sessions. See
+	// newStorage.
+	Storage StorageConfig `json:"storage"`
+
+	// ClientKeyAlgorithm selects the asymmetric key algorithm generated
+	// for newly registered clients: "rsa" (the default, sized by
+	// KeySize), "ecdsa-p256", "ecdsa-p384", or "ed25519". Existing clients keep whatever algorithm
+	// they were registered with; this only affects new registrations.
+	ClientKeyAlgorithm string `json:"client_key_algorithm"`
+
+	// VanityKeyTimeoutSeconds bounds how long generateAndRegisterClient
+	// may spend searching for a client key matching a RegistrationOTP's
+	// FingerprintPrefix (see findVanityKeyPair) before giving up. 0
+	// defaults to 30 seconds.
+	VanityKeyTimeoutSeconds int `json:"vanity_key_timeout_seconds"`
+
+	// ClientCA configures the CSR-based enrollment path (see
+	// issueCertificateForClient): a client that already holds its own
+	// key pair can present a PKCS#10 CSR to /register instead of having
+	// the server generate and transmit a private key. Leaving both
+	// fields empty disables this path; /register only ever generates
+	// raw key pairs.
+	ClientCA ClientCAConfig `json:"client_ca"`
+
+	// AuthClockSkewSeconds bounds how far a JWS bearer token's iat/exp
+	// may drift from the server's clock before it is rejected. Defaults
+	// to 60 seconds when 0.
+	AuthClockSkewSeconds int64 `json:"auth_clock_skew_seconds"`
+
+	// DeprecatedPrivateKeyAuth re-enables the legacy "Authorization:
+	// Client <base64 PKCS1 private key>" scheme, in which the client's
+	// private key itself was transmitted on every request. It is kept
+	// only to let existing clients migrate to JWS bearer tokens (see
+	// verifyJWS) and will be removed in a future release.
+	DeprecatedPrivateKeyAuth bool `json:"deprecated_private_key_auth"`
+
+	// AccessLog sends per-request completion lines to their own
+	// lumberjack-rotated file instead of the main application log. See
+	// AccessLoggingMiddleware.
+	AccessLog AccessLogConfig `json:"access_log"`
+
+	// ErrorReporter forwards panics and 5xx errors to an external
+	// error-tracking or observability backend, in addition to slog. See
+	// newErrorReporter.
+	ErrorReporter ErrorReporterConfig `json:"error_reporter"`
+
+	// EventSubscribers configures pluggable consumers of registration
+	// lifecycle events (OTP created/consumed/expired, client
+	// registered/expired/revoked; see RegistrationEvent). See
+	// initEventSubscribers.
+	EventSubscribers EventSubscribersConfig `json:"event_subscribers"`
+}
+
+// EventSubscribersConfig selects the built-in registration-event
+// subscribers. Each is independently optional: leaving its URL/Address
+// empty disables it, and any number of them may be active at once.
+type EventSubscribersConfig struct {
+	Webhook WebhookSubscriberConfig `json:"webhook"`
+	Syslog  EventSyslogConfig       `json:"syslog"`
+}
+
+// WebhookSubscriberConfig configures an HTTP webhook that receives a
+// POST with a JSON-encoded RegistrationEvent for every lifecycle event.
+// Leaving URL empty disables it.
+type WebhookSubscriberConfig struct {
+	URL string `json:"url"`
+
+	// Secret, when set, signs the request body with HMAC-SHA256 and
+	// sends it in the X-BEM-Signature header ("sha256=<hex>") so the
+	// receiver can verify the POST actually came from this server.
+	Secret string `json:"secret"`
+
+	// TimeoutSeconds bounds how long the POST may take; 0 defaults to 5s.
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// EventSyslogConfig configures an RFC 5424 syslog subscriber for
+// registration lifecycle events. This is independent of the "syslog"
+// log sink (see SyslogConfig) used for application logging, so events
+// can target a different collector. Leaving Address empty disables it.
+type EventSyslogConfig struct {
+	Network string `json:"network"` // "udp" or "tcp"; default "udp"
+	Address string `json:"address"`
+
+	// AppName is the RFC 5424 APP-NAME field; default "bem".
+	AppName string `json:"app_name"`
+}
+
+// ErrorReporterConfig selects and configures the ErrorReporter used by
+// RecoveryMiddleware and ErrorLoggingMiddleware. Driver may be "" (no
+// reporter, the default), "sentry", or "otlp".
+type ErrorReporterConfig struct {
+	Driver string `json:"driver"`
+
+	// SentryDSN is required when Driver is "sentry".
+	SentryDSN string `json:"sentry_dsn"`
+
+	// OTLPEndpoint is the OTLP/gRPC logs collector address (e.g.
+	// "localhost:4317"), required when Driver is "otlp".
+	OTLPEndpoint string `json:"otlp_endpoint"`
+	OTLPInsecure bool   `json:"otlp_insecure"`
+}
+
+// CacheBackendConfig selects and configures the bfrest.CacheBackend each
+// BigFix server's hot tier uses. Driver may be "" (in-memory, the
+// default), "fs", "redis", or "badger"; see bfrest.BackendConfig.
+type CacheBackendConfig struct {
+	Driver string `json:"driver"`
+
+	// FSDir is required when Driver is "fs".
+	FSDir string `json:"fs_dir"`
+
+	// RedisAddr is required when Driver is "redis".
+	RedisAddr     string `json:"redis_addr"`
+	RedisPassword string `json:"redis_password"`
+	RedisDB       int    `json:"redis_db"`
+
+	// BadgerDir is required when Driver is "badger".
+	BadgerDir string `json:"badger_dir"`
+}
+
+// AccessLogConfig configures the dedicated access-log stream. Format is
+// a text/template string rendered against an AccessLogEntry; leaving it
+// empty uses defaultAccessLogFormat (an Apache/Nginx combined-log-style
+// line).
+type AccessLogConfig struct {
+	Enabled    bool   `json:"enabled"`
+	FilePath   string `json:"file_path"`
+	MaxSizeMB  int    `json:"max_size_mb"`
+	MaxBackups int    `json:"max_backups"`
+	MaxAgeDays int    `json:"max_age_days"`
+	Compress   bool   `json:"compress"`
+	Format     string `json:"format"`
+
+	// ExcludePathPrefixes skips logging for requests whose path starts
+	// with one of these prefixes (e.g. "/healthz").
+	ExcludePathPrefixes []string `json:"exclude_path_prefixes"`
+
+	// ExcludeStatuses skips logging for requests that complete with one
+	// of these exact status codes, regardless of path (e.g. excluding
+	// 2xx responses still requires listing each code: [200, 201, 204]).
+	ExcludeStatuses []int `json:"exclude_statuses"`
+}
+
+// StorageConfig selects the bemstore.Storage driver. Driver may be
+// "file" (the default: JSON files in RegistrationDataDir), "bolt" (a
+// single-node embedded database at BoltPath), or "etcd" (shared across
+// replicas via EtcdEndpoints). Running multiple BEM instances behind a
+// load balancer requires "etcd" so they observe the same registration
+// state.
+type StorageConfig struct {
+	Driver        string   `json:"driver"`
+	BoltPath      string   `json:"bolt_path"`
+	EtcdEndpoints []string `json:"etcd_endpoints"`
+	EtcdPrefix    string   `json:"etcd_prefix"`
+	EtcdUsername  string   `json:"etcd_username"`
+	EtcdPassword  string   `json:"etcd_password"`
+}
+
+// ClientCAConfig points at the PEM certificate and private key of the
+// CA used to sign client enrollment CSRs. If the files don't exist yet,
+// initClientCA bootstraps a self-signed CA and writes it to these paths.
+type ClientCAConfig struct {
+	CertPath string `json:"cert_path"`
+	KeyPath  string `json:"key_path"`
 }
 
 type BigFixServer struct {
@@ -42,15 +299,137 @@ type BigFixServer struct {
 	Password string `json:"password"`
 	MaxAge   uint64 `json:"maxage"`
 	PoolSize int    `json:"poolsize"`
+
+	// MaxPayloadSize overrides Config.CacheMaxPayloadSize for this server
+	// alone, in bytes. 0 means "inherit the global default".
+	MaxPayloadSize uint64 `json:"max_payload_size"`
+
+	// StaleWhileRevalidate and StaleIfError override Config's fields of
+	// the same name for this server alone. 0 means "inherit the global
+	// default".
+	StaleWhileRevalidate uint64 `json:"stale_while_revalidate"`
+	StaleIfError         uint64 `json:"stale_if_error"`
+
+	// TLS options for this server's connection pool. CAFile/ClientCertFile/
+	// ClientKeyFile are PEM file paths, left empty to use the system root
+	// CAs and no client certificate. Insecure disables certificate
+	// verification entirely and should only be used against lab servers.
+	CAFile         string `json:"ca_file"`
+	ClientCertFile string `json:"client_cert_file"`
+	ClientKeyFile  string `json:"client_key_file"`
+	Insecure       bool   `json:"insecure"`
 }
 
 // Registration and client management structures
+
+// RegistrationOTP is a B2-style application key: in addition to the
+// client/key pair it can carry a capability set, a client-name prefix
+// restriction, a maximum lifetime for anything minted from it, and a
+// list of CIDRs the presenter's remote IP must fall within. Any field
+// an older or newer admin tool doesn't know about round-trips through
+// Extra instead of being silently dropped.
 type RegistrationOTP struct {
 	ClientName      string    `json:"client_name"`
 	OneTimeKey      string    `json:"one_time_key"`
 	KeyLifespanDays int       `json:"key_lifespan_days,omitempty"` // 0 = never expires
 	CreatedAt       time.Time `json:"created_at"`
 	RequestedBy     string    `json:"requested_by,omitempty"`
+
+	// Capabilities this key (and anything minted from it) is allowed to
+	// exercise, e.g. "query:read", "action:submit", "admin:register".
+	// An empty slice means "no capability restriction" for backward
+	// compatibility with keys issued before this field existed.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// NamePrefix restricts registration to ClientNames that start with
+	// this value. Empty means no restriction.
+	NamePrefix string `json:"name_prefix,omitempty"`
+
+	// ValidDuration bounds, in seconds, how long anything minted using
+	// this key may remain valid. A child key/session can never outlive
+	// its parent. 0 means unbounded (subject to KeyLifespanDays).
+	ValidDuration int64 `json:"valid_duration,omitempty"`
+
+	// AllowedCIDRs restricts which remote IPs may present this key.
+	// Empty means no restriction.
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+
+	// KeyAlgorithm selects the asymmetric key algorithm generated for the
+	// client minted from this OTP: "rsa", "ecdsa-p256", "ecdsa-p384", or
+	// "ed25519". Empty (as in OTP batches written before this field
+	// existed) falls back to the server's Config.ClientKeyAlgorithm,
+	// which is itself "rsa" when unset.
+	KeyAlgorithm string `json:"key_algorithm,omitempty"`
+
+	// FingerprintPrefix, when set, constrains generateAndRegisterClient
+	// to keep generating key pairs until one's SPKI SHA-256 fingerprint
+	// starts with this hex string (case-insensitive), giving fleet
+	// operators memorable/routable client identities for audit trails.
+	// See findVanityKeyPair. Up to maxFingerprintPrefixLen (6) hex
+	// characters; longer values are rejected.
+	FingerprintPrefix string `json:"fingerprint_prefix,omitempty"`
+
+	// Extra preserves any fields this version of BEM doesn't recognize
+	// so admins can hand-edit registration files without data loss.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// registrationOTPAlias avoids infinite recursion when RegistrationOTP's
+// MarshalJSON/UnmarshalJSON re-encode the known fields.
+type registrationOTPAlias RegistrationOTP
+
+// MarshalJSON re-emits the known fields plus anything stashed in Extra.
+func (o RegistrationOTP) MarshalJSON() ([]byte, error) {
+	known, err := json.Marshal(registrationOTPAlias(o))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(o.Extra) == 0 {
+		return known, nil
+	}
+
+	merged := make(map[string]json.RawMessage, len(o.Extra)+8)
+	if err := json.Unmarshal(known, &merged); err != nil {
+		return nil, err
+	}
+	for k, v := range o.Extra {
+		if _, exists := merged[k]; !exists {
+			merged[k] = v
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// UnmarshalJSON populates the known fields and stashes anything else in
+// Extra so it survives a save/load round trip untouched.
+func (o *RegistrationOTP) UnmarshalJSON(data []byte) error {
+	var alias registrationOTPAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	*o = RegistrationOTP(alias)
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	known := map[string]bool{
+		"client_name": true, "one_time_key": true, "key_lifespan_days": true,
+		"created_at": true, "requested_by": true, "capabilities": true,
+		"name_prefix": true, "valid_duration": true, "allowed_cidrs": true,
+		"key_algorithm": true, "fingerprint_prefix": true,
+	}
+	for k, v := range raw {
+		if !known[k] {
+			if o.Extra == nil {
+				o.Extra = make(map[string]json.RawMessage)
+			}
+			o.Extra[k] = v
+		}
+	}
+	return nil
 }
 
 type RegisteredClient struct {
@@ -60,33 +439,67 @@ type RegisteredClient struct {
 	ExpiresAt       *time.Time `json:"expires_at,omitempty"` // nil if never expires
 	LastUsed        time.Time  `json:"last_used,omitempty"`
 	KeyLifespanDays int        `json:"key_lifespan_days"`
+
+	// Capabilities stamped onto this client at registration time: the
+	// intersection of the issuing OTP's Capabilities and any narrower
+	// set the client requested.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// CertificatePEM and CertificateFingerprint are set when this client
+	// was enrolled via a CSR (see issueCertificateForClient) instead of
+	// generateAndRegisterClient's server-generated key pair.
+	CertificatePEM         string `json:"certificate_pem,omitempty"`
+	CertificateFingerprint string `json:"certificate_fingerprint,omitempty"`
 }
 
 // API request/response structures
 type RegisterRequest struct {
 	ClientName string `json:"client_name"`
 	OneTimeKey string `json:"one_time_key"`
+
+	// RequestedCapabilities optionally narrows the capability set the
+	// issued client is stamped with. The server always intersects this
+	// with the OTP's own Capabilities; a client can never gain a
+	// capability the OTP didn't already grant.
+	RequestedCapabilities []string `json:"requested_capabilities,omitempty"`
+
+	// CSR, if present, is a PEM-encoded PKCS#10 certificate signing
+	// request generated by the client itself. Its presence switches
+	// registration to issueCertificateForClient: the server signs the
+	// CSR against Config.ClientCA instead of generating and returning a
+	// private key, so the key never crosses the wire. Requires
+	// Config.ClientCA to be configured; otherwise registration fails.
+	CSR string `json:"csr,omitempty"`
 }
 
 type RegisterResponse struct {
 	Success    bool   `json:"success"`
 	PrivateKey string `json:"private_key,omitempty"` // PEM-encoded private key
 	Message    string `json:"message,omitempty"`
+
+	// CertificatePEM is set instead of PrivateKey when registration used
+	// the CSR flow: the client already holds the private key, so only
+	// the signed certificate needs to come back.
+	CertificatePEM string `json:"certificate_pem,omitempty"`
 }
 
 // Global state variables
 var (
 	// Global configuration
-	appConfig             *Config
-
-	// Global state for client registration
-	registrationOTPs      []RegistrationOTP
-	registeredClients     []RegisteredClient
-	registrationMutex     sync.RWMutex
-	configDir            string
-	registrationDataDir  string
-
-	// Session management for cookie-based admin access
-	activeSessions        map[string]time.Time // sessionToken -> expiresAt
-	sessionMutex          sync.RWMutex
-)
\ No newline at end of file
+	appConfig *Config
+
+	// configFilePath is where appConfig was loaded from, and where the
+	// runtime /admin/servers endpoints persist changes back to. configMu
+	// serializes read-modify-write updates to appConfig.BigFixServers
+	// and the on-disk file together.
+	configFilePath string
+	configMu       sync.Mutex
+
+	// store is the persistence backend for registration OTPs, registered
+	// clients, and admin sessions, selected by Config.Storage.Driver; see
+	// newStorage.
+	store bemstore.Storage
+
+	configDir           string
+	registrationDataDir string
+)
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxFingerprintPrefixLen bounds RegistrationOTP.FingerprintPrefix: 6
+// hex characters is ~16M candidate keys to search on average, which
+// keeps findVanityKeyPair's worst case bounded even before timeout
+// kicks in.
+const maxFingerprintPrefixLen = 6
+
+// defaultVanityKeyTimeout is used when Config.VanityKeyTimeoutSeconds is 0.
+const defaultVanityKeyTimeout = 30 * time.Second
+
+// vanityProgressInterval controls how often findVanityKeyPair logs
+// attempts/sec and an ETA while searching.
+const vanityProgressInterval = 2 * time.Second
+
+// vanityKeyTimeoutFromConfig resolves Config.VanityKeyTimeoutSeconds
+// into a duration: 0 (or negative) -> defaultVanityKeyTimeout.
+func vanityKeyTimeoutFromConfig(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultVanityKeyTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// vanityKeyResult carries a matching key pair back from whichever
+// worker goroutine in findVanityKeyPair finds it first.
+type vanityKeyResult struct {
+	privateKeyPEM string
+	publicKeyPEM  string
+}
+
+// findVanityKeyPair fans out to runtime.NumCPU() worker goroutines,
+// each repeatedly generating a candidate key pair of the given
+// algorithm/rsaKeySize and hashing its SPKI DER (the same bytes
+// x509.MarshalPKIXPublicKey produces, before the generateClientKeyPair
+// caller wraps them in the "PUBLIC KEY" PEM block) with SHA-256, until
+// one's hex-encoded fingerprint starts with prefix (case-insensitive)
+// or timeout elapses. Progress is logged periodically via slog so an
+// admin can gauge whether a given prefix length is actually feasible.
+func findVanityKeyPair(algorithm string, rsaKeySize int, prefix string, timeout time.Duration) (privateKeyPEM, publicKeyPEM string, err error) {
+	prefix = strings.ToLower(prefix)
+	if len(prefix) > maxFingerprintPrefixLen {
+		return "", "", fmt.Errorf("fingerprint_prefix %q exceeds the %d hex character maximum", prefix, maxFingerprintPrefixLen)
+	}
+	if timeout <= 0 {
+		timeout = defaultVanityKeyTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	results := make(chan vanityKeyResult, 1)
+	var attempts int64
+
+	// found is closed the instant a worker commits a match to results,
+	// so sibling workers stop promptly. It's deliberately separate from
+	// ctx: canceling ctx here would race the consumer's own select
+	// between the buffered send on results becoming ready and ctx.Done()
+	// becoming ready at essentially the same instant, and Go picks
+	// pseudo-randomly among simultaneously-ready cases - silently
+	// discarding the match about half the time. Leaving ctx's deadline
+	// to fire only on a genuine timeout keeps that race out of the
+	// consumer loop below.
+	found := make(chan struct{})
+	var foundOnce sync.Once
+
+	workers := runtime.NumCPU()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-found:
+					return
+				default:
+				}
+
+				candidatePrivPEM, candidatePubPEM, genErr := generateClientKeyPair(algorithm, rsaKeySize)
+				atomic.AddInt64(&attempts, 1)
+				if genErr != nil {
+					continue
+				}
+				if fingerprintMatchesPrefix(candidatePubPEM, prefix) {
+					select {
+					case results <- vanityKeyResult{privateKeyPEM: candidatePrivPEM, publicKeyPEM: candidatePubPEM}:
+						foundOnce.Do(func() { close(found) })
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(vanityProgressInterval)
+	defer ticker.Stop()
+
+	// Average-case attempts for a uniformly distributed hex prefix of
+	// this length, used only to estimate an ETA for the progress log.
+	estimatedAttempts := math.Pow(16, float64(len(prefix)))
+
+	for {
+		select {
+		case result := <-results:
+			slog.Info("Vanity fingerprint match found",
+				"fingerprint_prefix", prefix,
+				"attempts", atomic.LoadInt64(&attempts),
+				"elapsed", time.Since(start).Round(time.Millisecond))
+			return result.privateKeyPEM, result.publicKeyPEM, nil
+
+		case <-ticker.C:
+			n := atomic.LoadInt64(&attempts)
+			rate := float64(n) / time.Since(start).Seconds()
+			eta := "unknown"
+			if rate > 0 {
+				remaining := estimatedAttempts - float64(n)
+				if remaining < 0 {
+					remaining = 0
+				}
+				eta = time.Duration(remaining / rate * float64(time.Second)).Round(time.Second).String()
+			}
+			slog.Info("Searching for vanity fingerprint",
+				"fingerprint_prefix", prefix,
+				"attempts", n,
+				"attempts_per_sec", fmt.Sprintf("%.0f", rate),
+				"eta", eta)
+
+		case <-ctx.Done():
+			return "", "", fmt.Errorf("timed out after %s searching for fingerprint prefix %q (%d attempts)", timeout, prefix, atomic.LoadInt64(&attempts))
+		}
+	}
+}
+
+// fingerprintMatchesPrefix reports whether publicKeyPEM's SHA-256 SPKI
+// fingerprint starts with prefix. publicKeyPEM is expected to be a
+// "PUBLIC KEY" PEM block wrapping an x509.MarshalPKIXPublicKey DER, as
+// produced by generateClientKeyPair.
+func fingerprintMatchesPrefix(publicKeyPEM, prefix string) bool {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return false
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return strings.HasPrefix(hex.EncodeToString(sum[:]), prefix)
+}
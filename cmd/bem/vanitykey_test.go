@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFindVanityKeyPairDoesNotRaceTimeout guards against a race between
+// the worker's buffered send on results and its cancel of ctx: with an
+// empty prefix every candidate matches on the first attempt, so a match
+// is always found almost instantly and the call should never return a
+// timeout error. Before the fix, canceling ctx right after the send let
+// the consumer's select pick ctx.Done() instead of results roughly half
+// the time. Run repeatedly to catch that flakiness.
+func TestFindVanityKeyPairDoesNotRaceTimeout(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		_, pub, err := findVanityKeyPair("ed25519", 0, "", 2*time.Second)
+		if err != nil {
+			t.Fatalf("iteration %d: unexpected error (likely the find/cancel race): %v", i, err)
+		}
+		if pub == "" {
+			t.Fatalf("iteration %d: expected a non-empty public key", i)
+		}
+	}
+}
+
+func TestFindVanityKeyPairMatchesPrefix(t *testing.T) {
+	_, pub, err := findVanityKeyPair("ed25519", 0, "0", 5*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(pub, "-----BEGIN PUBLIC KEY-----") {
+		t.Fatalf("expected a PEM-encoded public key, got %q", pub)
+	}
+}
+
+func TestFindVanityKeyPairRejectsOverlongPrefix(t *testing.T) {
+	_, _, err := findVanityKeyPair("ed25519", 0, strings.Repeat("a", maxFingerprintPrefixLen+1), time.Second)
+	if err == nil {
+		t.Fatal("expected an error for a prefix longer than maxFingerprintPrefixLen")
+	}
+}
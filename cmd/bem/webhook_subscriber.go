@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// defaultWebhookTimeout is used when WebhookSubscriberConfig.TimeoutSeconds is 0.
+const defaultWebhookTimeout = 5 * time.Second
+
+// webhookSubscriber POSTs a JSON-encoded RegistrationEvent to a fixed
+// URL for every event on the bus, signing the body with HMAC-SHA256 so
+// the receiver can verify it actually came from this server.
+type webhookSubscriber struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// newWebhookSubscriber builds a webhookSubscriber from config. Callers
+// should only construct one when config.URL is non-empty.
+func newWebhookSubscriber(config WebhookSubscriberConfig) *webhookSubscriber {
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	return &webhookSubscriber{
+		url:    config.URL,
+		secret: config.Secret,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Handle POSTs event as JSON, signing the body with HMAC-SHA256 (when
+// Secret is set) in the X-BEM-Signature header as "sha256=<hex>".
+// Delivery failures are logged and dropped, not retried.
+func (w *webhookSubscriber) Handle(event RegistrationEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to marshal event for webhook subscriber", "error", err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Failed to build webhook event request", "url", w.url, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write(body)
+		req.Header.Set("X-BEM-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		slog.Error("Webhook event delivery failed", "url", w.url, "event_type", event.Type, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		slog.Error("Webhook event delivery rejected", "url", w.url, "event_type", event.Type, "status", resp.StatusCode)
+	}
+}
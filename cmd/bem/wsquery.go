@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest"
+)
+
+const (
+	wsPingInterval    = 20 * time.Second
+	wsDefaultTimeout  = 60 * time.Second
+	wsDefaultMaxRows  = 0 // 0 = unbounded
+	wsWriteWaitPeriod = 10 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Mobile clients connect from arbitrary origins; auth is enforced by
+	// RequireCap before the handshake, same as every other protected route.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsRowFrame is one newline-delimited JSON frame sent to the client.
+// Individual frames stay small (one row) so proxies and middleboxes
+// that truncate large WebSocket messages (a known grpc-websocket-proxy
+// failure mode) can't silently corrupt a frame.
+type wsRowFrame struct {
+	Row *bfrest.Row `json:"row,omitempty"`
+	// Done is set on the final frame instead of abruptly closing, so the
+	// client can distinguish "finished" from "connection dropped".
+	Done  bool   `json:"done,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleWSQueryEndpoint streams a relevance query's result rows to the
+// client as they arrive, instead of buffering the full XML response.
+// Query parameters: url (required, the relevance query to run),
+// max_rows (optional cap on rows sent), timeout (optional seconds,
+// default wsDefaultTimeout).
+func handleWSQueryEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
+	queryURL := c.Query("url")
+	if queryURL == "" {
+		c.JSON(400, gin.H{"error": "url parameter is required", "request_id": GetRequestID(c)})
+		return
+	}
+
+	maxRows := wsDefaultMaxRows
+	if v := c.Query("max_rows"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			maxRows = parsed
+		}
+	}
+
+	timeout := wsDefaultTimeout
+	if v := c.Query("timeout"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			timeout = time.Duration(parsed) * time.Second
+		}
+	}
+
+	pool, err := cache.PoolFor(queryURL)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error(), "request_id": GetRequestID(c)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	conn, err := pool.AcquireContext(ctx)
+	if err != nil {
+		c.JSON(503, gin.H{"error": err.Error(), "request_id": GetRequestID(c)})
+		return
+	}
+
+	ws, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.Error("WebSocket upgrade failed", "error", err, "request_id", GetRequestID(c))
+		pool.Release(conn)
+		return
+	}
+	defer ws.Close()
+
+	rows, errs := conn.Stream(ctx, queryURL)
+
+	// Client-initiated cancellation (a close frame, or the connection
+	// dropping) must release the pooled connection promptly rather than
+	// waiting for the full query to finish.
+	go func() {
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	pingTicker := time.NewTicker(wsPingInterval)
+	defer pingTicker.Stop()
+
+	rowCount := 0
+	streamErr := error(nil)
+
+streamLoop:
+	for {
+		select {
+		case row, ok := <-rows:
+			if !ok {
+				break streamLoop
+			}
+			rowCount++
+			ws.SetWriteDeadline(time.Now().Add(wsWriteWaitPeriod))
+			if err := ws.WriteJSON(wsRowFrame{Row: &row}); err != nil {
+				streamErr = err
+				cancel()
+				break streamLoop
+			}
+			if maxRows > 0 && rowCount >= maxRows {
+				cancel()
+				break streamLoop
+			}
+		case err := <-errs:
+			streamErr = err
+		case <-pingTicker.C:
+			ws.SetWriteDeadline(time.Now().Add(wsWriteWaitPeriod))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				streamErr = err
+				break streamLoop
+			}
+		case <-ctx.Done():
+			if streamErr == nil {
+				streamErr = ctx.Err()
+			}
+			break streamLoop
+		}
+	}
+
+	if streamErr != nil {
+		pool.RecordFailure()
+		ws.WriteJSON(wsRowFrame{Error: streamErr.Error()})
+	} else {
+		pool.RecordSuccess()
+	}
+
+	ws.WriteJSON(wsRowFrame{Done: true})
+	pool.Release(conn)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest"
+)
+
+// wsWatchUpgrader uses a much larger buffer than wsUpgrader: a CacheEvent
+// itself is tiny, but this endpoint shares the same gorilla/websocket
+// connection machinery callers may reuse for other cache introspection,
+// and BigFix XML->JSON payloads can run into the megabytes, so the
+// default 64 KB frame buffer is too small to be a safe baseline here.
+var wsWatchUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4 << 20, // 4 MiB
+	WriteBufferSize: 4 << 20,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// wsWatchFrame is one JSON frame sent to a /watch subscriber.
+type wsWatchFrame struct {
+	Event *bfrest.CacheEvent `json:"event,omitempty"`
+	Error string             `json:"error,omitempty"`
+}
+
+// handleWatchEndpoint upgrades to a WebSocket and streams bfrest cache
+// events (created/refreshed/unchanged/expired) to the client as they
+// happen. Query parameters: server (optional, matches a server's base
+// URL by prefix) and url_glob (optional, a path.Match-style glob over
+// the cached URL).
+func handleWatchEndpoint(c *gin.Context, cache *bfrest.BigFixCache) {
+	if !requireAuth(c) {
+		return
+	}
+
+	filter := bfrest.EventFilter{
+		ServerPrefix: c.Query("server"),
+		URLGlob:      c.Query("url_glob"),
+	}
+
+	events, cancelSub := cache.Subscribe(filter)
+	defer cancelSub()
+
+	ws, err := wsWatchUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.Error("WebSocket upgrade failed", "error", err, "request_id", GetRequestID(c))
+		return
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// A closed connection (or a client close frame) should stop the
+	// stream promptly rather than leaking the subscription until the
+	// request context is torn down some other way.
+	go func() {
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	pingTicker := time.NewTicker(wsPingInterval)
+	defer pingTicker.Stop()
+
+watchLoop:
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				break watchLoop
+			}
+			ws.SetWriteDeadline(time.Now().Add(wsWriteWaitPeriod))
+			if err := ws.WriteJSON(wsWatchFrame{Event: &ev}); err != nil {
+				break watchLoop
+			}
+		case <-pingTicker.C:
+			ws.SetWriteDeadline(time.Now().Add(wsWriteWaitPeriod))
+			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				break watchLoop
+			}
+		case <-ctx.Done():
+			break watchLoop
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package bemstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	otpsBucket = []byte("otps")
+	// otpsByKeyBucket secondary-indexes otpsBucket by OneTimeKey alone
+	// (mapping it to the otpsBucket composite key), so GetOTPByKey - the
+	// lookup every /register call makes - is a single Get instead of a
+	// full bucket scan.
+	otpsByKeyBucket = []byte("otps_by_key")
+	clientsBucket   = []byte("clients")
+	sessionsBucket  = []byte("sessions")
+)
+
+// BoltStore persists OTPs, clients, and sessions in a single embedded
+// bbolt database file. It is single-node: the file is locked exclusively
+// by the process holding it open, so it doesn't help horizontal scaling
+// but does survive restarts without the JSON-file backup/rename dance.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (creating if necessary) a bbolt database at path.
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{otpsBucket, otpsByKeyBucket, clientsBucket, sessionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt buckets: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func otpKey(clientName, oneTimeKey string) []byte {
+	return []byte(clientName + "\x00" + oneTimeKey)
+}
+
+func (bs *BoltStore) PutOTP(otp OTP) error {
+	data, err := json.Marshal(otp)
+	if err != nil {
+		return err
+	}
+	key := otpKey(otp.ClientName, otp.OneTimeKey)
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(otpsBucket).Put(key, data); err != nil {
+			return err
+		}
+		return tx.Bucket(otpsByKeyBucket).Put([]byte(otp.OneTimeKey), key)
+	})
+}
+
+func (bs *BoltStore) ListOTPs() ([]OTP, error) {
+	var out []OTP
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(otpsBucket).ForEach(func(k, v []byte) error {
+			var otp OTP
+			if err := json.Unmarshal(v, &otp); err != nil {
+				return err
+			}
+			out = append(out, otp)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (bs *BoltStore) GetOTPByKey(oneTimeKey string) (OTP, error) {
+	var otp OTP
+	found := false
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		compositeKey := tx.Bucket(otpsByKeyBucket).Get([]byte(oneTimeKey))
+		if compositeKey == nil {
+			return nil
+		}
+		data := tx.Bucket(otpsBucket).Get(compositeKey)
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &otp)
+	})
+	if err != nil {
+		return OTP{}, err
+	}
+	if !found {
+		return OTP{}, ErrNotFound
+	}
+	return otp, nil
+}
+
+func (bs *BoltStore) DeleteOTP(clientName, oneTimeKey string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(otpsBucket).Delete(otpKey(clientName, oneTimeKey)); err != nil {
+			return err
+		}
+		return tx.Bucket(otpsByKeyBucket).Delete([]byte(oneTimeKey))
+	})
+}
+
+func (bs *BoltStore) PutClient(client Client) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(clientsBucket).Put([]byte(client.ClientName), data)
+	})
+}
+
+func (bs *BoltStore) ListClients() ([]Client, error) {
+	var out []Client
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(clientsBucket).ForEach(func(k, v []byte) error {
+			var client Client
+			if err := json.Unmarshal(v, &client); err != nil {
+				return err
+			}
+			out = append(out, client)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (bs *BoltStore) GetClientByPublicKey(publicKeyPEM string) (Client, error) {
+	var found *Client
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(clientsBucket).ForEach(func(k, v []byte) error {
+			if found != nil {
+				return nil
+			}
+			var client Client
+			if err := json.Unmarshal(v, &client); err != nil {
+				return err
+			}
+			if client.PublicKey == publicKeyPEM {
+				found = &client
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return Client{}, err
+	}
+	if found == nil {
+		return Client{}, ErrNotFound
+	}
+	return *found, nil
+}
+
+func (bs *BoltStore) GetClientByName(clientName string) (Client, error) {
+	var client Client
+	found := false
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(clientsBucket).Get([]byte(clientName))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &client)
+	})
+	if err != nil {
+		return Client{}, err
+	}
+	if !found {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (bs *BoltStore) TouchClient(clientName string, lastUsed time.Time) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(clientsBucket)
+		data := bucket.Get([]byte(clientName))
+		if data == nil {
+			return nil
+		}
+		var client Client
+		if err := json.Unmarshal(data, &client); err != nil {
+			return err
+		}
+		client.LastUsed = lastUsed
+		updated, err := json.Marshal(client)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(clientName), updated)
+	})
+}
+
+func (bs *BoltStore) IsClientRegistered(clientName string) (bool, error) {
+	registered := false
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(clientsBucket).Get([]byte(clientName))
+		if data == nil {
+			return nil
+		}
+		var client Client
+		if err := json.Unmarshal(data, &client); err != nil {
+			return err
+		}
+		if client.Revoked {
+			return nil
+		}
+		if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
+			return nil
+		}
+		registered = true
+		return nil
+	})
+	return registered, err
+}
+
+func (bs *BoltStore) RevokeClient(clientName string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(clientsBucket)
+		data := bucket.Get([]byte(clientName))
+		if data == nil {
+			return nil
+		}
+		var client Client
+		if err := json.Unmarshal(data, &client); err != nil {
+			return err
+		}
+		client.Revoked = true
+		updated, err := json.Marshal(client)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(clientName), updated)
+	})
+}
+
+func (bs *BoltStore) PutSession(session Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put([]byte(session.Token), data)
+	})
+}
+
+func (bs *BoltStore) GetSession(token string) (Session, error) {
+	var session Session
+	found := false
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(sessionsBucket).Get([]byte(token))
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &session); err != nil {
+			return err
+		}
+		found = true
+		return nil
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	if !found || time.Now().After(session.ExpiresAt) {
+		if found {
+			bs.DeleteSession(token)
+		}
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (bs *BoltStore) ListSessions() ([]Session, error) {
+	var out []Session
+	now := time.Now()
+	err := bs.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+			if now.After(session.ExpiresAt) {
+				return nil
+			}
+			out = append(out, session)
+			return nil
+		})
+	})
+	return out, err
+}
+
+func (bs *BoltStore) DeleteSession(token string) error {
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete([]byte(token))
+	})
+}
+
+func (bs *BoltStore) CleanupExpired(otpTTL time.Duration) error {
+	now := time.Now()
+	return bs.db.Update(func(tx *bolt.Tx) error {
+		if otpTTL > 0 {
+			otps := tx.Bucket(otpsBucket)
+			otpsByKey := tx.Bucket(otpsByKeyBucket)
+			var expiredOTPs []OTP
+			err := otps.ForEach(func(k, v []byte) error {
+				var otp OTP
+				if err := json.Unmarshal(v, &otp); err != nil {
+					return err
+				}
+				if now.After(otp.CreatedAt.Add(otpTTL)) {
+					expiredOTPs = append(expiredOTPs, otp)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, otp := range expiredOTPs {
+				if err := otps.Delete(otpKey(otp.ClientName, otp.OneTimeKey)); err != nil {
+					return err
+				}
+				if err := otpsByKey.Delete([]byte(otp.OneTimeKey)); err != nil {
+					return err
+				}
+			}
+		}
+
+		sessions := tx.Bucket(sessionsBucket)
+		var expiredSessions [][]byte
+		err := sessions.ForEach(func(k, v []byte) error {
+			var session Session
+			if err := json.Unmarshal(v, &session); err != nil {
+				return err
+			}
+			if now.After(session.ExpiresAt) {
+				expiredSessions = append(expiredSessions, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expiredSessions {
+			if err := sessions.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		clients := tx.Bucket(clientsBucket)
+		var expiredClients [][]byte
+		err = clients.ForEach(func(k, v []byte) error {
+			var client Client
+			if err := json.Unmarshal(v, &client); err != nil {
+				return err
+			}
+			if client.ExpiresAt != nil && now.After(*client.ExpiresAt) {
+				expiredClients = append(expiredClients, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expiredClients {
+			if err := clients.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
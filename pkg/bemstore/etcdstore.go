@@ -0,0 +1,409 @@
+package bemstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// EtcdStore shares OTPs, clients, and sessions across multiple BEM
+// replicas behind a load balancer via an etcd cluster. Sessions, OTPs
+// that carry a ValidDuration, and clients that carry an ExpiresAt are
+// written with a lease so they expire on the server side even if
+// CleanupExpired is never called; everything else (clients with no
+// ExpiresAt, OTPs with no ValidDuration) is durable until explicitly
+// deleted.
+type EtcdStore struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// EtcdOptions configures EtcdStore's connection to the cluster.
+type EtcdOptions struct {
+	Endpoints   []string
+	DialTimeout time.Duration // 0 defaults to 5s
+	Username    string
+	Password    string
+}
+
+const defaultEtcdDialTimeout = 5 * time.Second
+
+// NewEtcdStore dials an etcd cluster and returns a Storage backed by it.
+// prefix namespaces all keys (e.g. "/bem/") so BEM can share a cluster
+// with other applications.
+func NewEtcdStore(prefix string, opts EtcdOptions) (*EtcdStore, error) {
+	dialTimeout := opts.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = defaultEtcdDialTimeout
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   opts.Endpoints,
+		DialTimeout: dialTimeout,
+		Username:    opts.Username,
+		Password:    opts.Password,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
+	}
+
+	return &EtcdStore{client: client, prefix: prefix}, nil
+}
+
+func (es *EtcdStore) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 5*time.Second)
+}
+
+func (es *EtcdStore) otpKey(clientName, oneTimeKey string) string {
+	return es.prefix + "otps/" + clientName + "\x00" + oneTimeKey
+}
+
+func (es *EtcdStore) clientKey(clientName string) string {
+	return es.prefix + "clients/" + clientName
+}
+
+func (es *EtcdStore) sessionKey(token string) string {
+	return es.prefix + "sessions/" + token
+}
+
+// leaseFor grants a lease that expires at expiresAt, or returns 0 (no
+// lease) if expiresAt is the zero value, meaning "never expires".
+func (es *EtcdStore) leaseFor(ctx context.Context, expiresAt time.Time) (clientv3.LeaseID, error) {
+	if expiresAt.IsZero() {
+		return 0, nil
+	}
+	ttl := int64(time.Until(expiresAt).Seconds())
+	if ttl < 1 {
+		ttl = 1
+	}
+	lease, err := es.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return lease.ID, nil
+}
+
+func (es *EtcdStore) PutOTP(otp OTP) error {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	data, err := json.Marshal(otp)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt time.Time
+	if otp.ValidDuration > 0 {
+		expiresAt = otp.CreatedAt.Add(time.Duration(otp.ValidDuration) * time.Second)
+	}
+	lease, err := es.leaseFor(ctx, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to grant lease for OTP: %w", err)
+	}
+
+	opts := []clientv3.OpOption{}
+	if lease != 0 {
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+
+	_, err = es.client.Put(ctx, es.otpKey(otp.ClientName, otp.OneTimeKey), string(data), opts...)
+	return err
+}
+
+func (es *EtcdStore) ListOTPs() ([]OTP, error) {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.prefix+"otps/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]OTP, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var otp OTP
+		if err := json.Unmarshal(kv.Value, &otp); err != nil {
+			return nil, err
+		}
+		out = append(out, otp)
+	}
+	return out, nil
+}
+
+func (es *EtcdStore) GetOTPByKey(oneTimeKey string) (OTP, error) {
+	otps, err := es.ListOTPs()
+	if err != nil {
+		return OTP{}, err
+	}
+	for _, otp := range otps {
+		if otp.OneTimeKey == oneTimeKey {
+			return otp, nil
+		}
+	}
+	return OTP{}, ErrNotFound
+}
+
+func (es *EtcdStore) DeleteOTP(clientName, oneTimeKey string) error {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	_, err := es.client.Delete(ctx, es.otpKey(clientName, oneTimeKey))
+	return err
+}
+
+func (es *EtcdStore) PutClient(client Client) error {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	data, err := json.Marshal(client)
+	if err != nil {
+		return err
+	}
+
+	var expiresAt time.Time
+	if client.ExpiresAt != nil {
+		expiresAt = *client.ExpiresAt
+	}
+	lease, err := es.leaseFor(ctx, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to grant lease for client: %w", err)
+	}
+
+	opts := []clientv3.OpOption{}
+	if lease != 0 {
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+
+	_, err = es.client.Put(ctx, es.clientKey(client.ClientName), string(data), opts...)
+	return err
+}
+
+func (es *EtcdStore) ListClients() ([]Client, error) {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.prefix+"clients/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Client, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var client Client
+		if err := json.Unmarshal(kv.Value, &client); err != nil {
+			return nil, err
+		}
+		out = append(out, client)
+	}
+	return out, nil
+}
+
+func (es *EtcdStore) GetClientByPublicKey(publicKeyPEM string) (Client, error) {
+	clients, err := es.ListClients()
+	if err != nil {
+		return Client{}, err
+	}
+	for _, client := range clients {
+		if client.PublicKey == publicKeyPEM {
+			return client, nil
+		}
+	}
+	return Client{}, ErrNotFound
+}
+
+func (es *EtcdStore) GetClientByName(clientName string) (Client, error) {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.clientKey(clientName))
+	if err != nil {
+		return Client{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return Client{}, ErrNotFound
+	}
+
+	var client Client
+	if err := json.Unmarshal(resp.Kvs[0].Value, &client); err != nil {
+		return Client{}, err
+	}
+	return client, nil
+}
+
+func (es *EtcdStore) TouchClient(clientName string, lastUsed time.Time) error {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.clientKey(clientName))
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+
+	var client Client
+	if err := json.Unmarshal(resp.Kvs[0].Value, &client); err != nil {
+		return err
+	}
+	client.LastUsed = lastUsed
+	return es.PutClient(client)
+}
+
+func (es *EtcdStore) IsClientRegistered(clientName string) (bool, error) {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.clientKey(clientName))
+	if err != nil {
+		return false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return false, nil
+	}
+
+	var client Client
+	if err := json.Unmarshal(resp.Kvs[0].Value, &client); err != nil {
+		return false, err
+	}
+	if client.Revoked {
+		return false, nil
+	}
+	if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (es *EtcdStore) RevokeClient(clientName string) error {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.clientKey(clientName))
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+
+	var client Client
+	if err := json.Unmarshal(resp.Kvs[0].Value, &client); err != nil {
+		return err
+	}
+	client.Revoked = true
+	return es.PutClient(client)
+}
+
+func (es *EtcdStore) PutSession(session Session) error {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	lease, err := es.leaseFor(ctx, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to grant lease for session: %w", err)
+	}
+
+	opts := []clientv3.OpOption{}
+	if lease != 0 {
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+
+	_, err = es.client.Put(ctx, es.sessionKey(session.Token), string(data), opts...)
+	return err
+}
+
+func (es *EtcdStore) GetSession(token string) (Session, error) {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.sessionKey(token))
+	if err != nil {
+		return Session{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return Session{}, ErrNotFound
+	}
+
+	var session Session
+	if err := json.Unmarshal(resp.Kvs[0].Value, &session); err != nil {
+		return Session{}, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (es *EtcdStore) ListSessions() ([]Session, error) {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	resp, err := es.client.Get(ctx, es.prefix+"sessions/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	out := make([]Session, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var session Session
+		if err := json.Unmarshal(kv.Value, &session); err != nil {
+			return nil, err
+		}
+		if now.After(session.ExpiresAt) {
+			continue
+		}
+		out = append(out, session)
+	}
+	return out, nil
+}
+
+func (es *EtcdStore) DeleteSession(token string) error {
+	ctx, cancel := es.ctx()
+	defer cancel()
+
+	_, err := es.client.Delete(ctx, es.sessionKey(token))
+	return err
+}
+
+// CleanupExpired is mostly a no-op: sessions and OTPs/clients with their
+// own ValidDuration/ExpiresAt are written with a lease, so etcd expires
+// them server-side without help. The one thing it does do is sweep OTPs
+// that carry no ValidDuration of their own (so got no lease) against
+// the generic otpTTL fallback, measured from CreatedAt.
+func (es *EtcdStore) CleanupExpired(otpTTL time.Duration) error {
+	if otpTTL <= 0 {
+		return nil
+	}
+
+	otps, err := es.ListOTPs()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, otp := range otps {
+		if otp.ValidDuration > 0 {
+			continue
+		}
+		if now.After(otp.CreatedAt.Add(otpTTL)) {
+			if err := es.DeleteOTP(otp.ClientName, otp.OneTimeKey); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (es *EtcdStore) Close() error {
+	return es.client.Close()
+}
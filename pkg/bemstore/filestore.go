@@ -0,0 +1,371 @@
+package bemstore
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore persists OTPs and registered clients as JSON files in a
+// directory, the historical BEM behavior. In memory they're kept as
+// maps keyed by OneTimeKey and ClientName respectively, so lookups and
+// updates are O(1) instead of a linear scan under the write lock; the
+// on-disk format stays a JSON array for compatibility with existing
+// hand-edited drop files and admin tooling. Sessions are kept in memory
+// only, matching the pre-bemstore behavior where a restart always
+// required clients to re-authenticate.
+type FileStore struct {
+	dir string
+
+	mu       sync.RWMutex
+	otps     map[string]OTP    // keyed by OneTimeKey
+	clients  map[string]Client // keyed by ClientName
+	sessions map[string]Session
+}
+
+// NewFileStore loads (or initializes) registration_otps.json and
+// registered_clients.json under dir.
+func NewFileStore(dir string) (*FileStore, error) {
+	fs := &FileStore{
+		dir:      dir,
+		otps:     make(map[string]OTP),
+		clients:  make(map[string]Client),
+		sessions: make(map[string]Session),
+	}
+
+	var otpList []OTP
+	if err := loadJSON(filepath.Join(dir, "registration_otps.json"), &otpList); err != nil {
+		return nil, fmt.Errorf("failed to load registration OTPs: %w", err)
+	}
+	for _, otp := range otpList {
+		fs.otps[otp.OneTimeKey] = otp
+	}
+
+	var clientList []Client
+	if err := loadJSON(filepath.Join(dir, "registered_clients.json"), &clientList); err != nil {
+		return nil, fmt.Errorf("failed to load registered clients: %w", err)
+	}
+	for _, client := range clientList {
+		fs.clients[client.ClientName] = client
+	}
+	fs.dropInvalidClientsLocked()
+
+	return fs, nil
+}
+
+// dropInvalidClientsLocked removes clients with an unparseable public
+// key (e.g. a hand-corrupted file) so a bad entry can't wedge auth.
+// Callers must hold no lock; this only runs during construction.
+func (fs *FileStore) dropInvalidClientsLocked() {
+	removed := false
+	for name, client := range fs.clients {
+		block, _ := pem.Decode([]byte(client.PublicKey))
+		if block == nil {
+			delete(fs.clients, name)
+			removed = true
+			continue
+		}
+		if _, err := x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			delete(fs.clients, name)
+			removed = true
+		}
+	}
+	if removed {
+		fs.saveClientsLocked()
+	}
+}
+
+func loadJSON(filename string, v interface{}) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// createBackup renames an existing file to <name>.bak.<n> before it is
+// overwritten, so an admin can recover from a bad hand-edit.
+func createBackup(filename string) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	}
+	for backupNum := 1; ; backupNum++ {
+		backupName := fmt.Sprintf("%s.bak.%d", filename, backupNum)
+		if _, err := os.Stat(backupName); os.IsNotExist(err) {
+			return os.Rename(filename, backupName)
+		}
+	}
+}
+
+// writeJSONAtomic backs up any existing file, then writes via a temp
+// file + rename so a crash mid-write can't corrupt the on-disk state.
+func writeJSONAtomic(filename string, v interface{}) error {
+	if err := createBackup(filename); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", filename, err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// saveOTPsLocked and saveClientsLocked flatten the in-memory maps back
+// to JSON arrays before writing, so the on-disk format is unaffected by
+// the in-memory indexing. Callers must hold fs.mu.
+func (fs *FileStore) saveOTPsLocked() error {
+	if err := os.MkdirAll(fs.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create registration data directory: %w", err)
+	}
+	list := make([]OTP, 0, len(fs.otps))
+	for _, otp := range fs.otps {
+		list = append(list, otp)
+	}
+	return writeJSONAtomic(filepath.Join(fs.dir, "registration_otps.json"), list)
+}
+
+func (fs *FileStore) saveClientsLocked() error {
+	if err := os.MkdirAll(fs.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create registration data directory: %w", err)
+	}
+	list := make([]Client, 0, len(fs.clients))
+	for _, client := range fs.clients {
+		list = append(list, client)
+	}
+	return writeJSONAtomic(filepath.Join(fs.dir, "registered_clients.json"), list)
+}
+
+func (fs *FileStore) PutOTP(otp OTP) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.otps[otp.OneTimeKey] = otp
+	return fs.saveOTPsLocked()
+}
+
+func (fs *FileStore) ListOTPs() ([]OTP, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	out := make([]OTP, 0, len(fs.otps))
+	for _, otp := range fs.otps {
+		out = append(out, otp)
+	}
+	return out, nil
+}
+
+func (fs *FileStore) GetOTPByKey(oneTimeKey string) (OTP, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	otp, ok := fs.otps[oneTimeKey]
+	if !ok {
+		return OTP{}, ErrNotFound
+	}
+	return otp, nil
+}
+
+func (fs *FileStore) DeleteOTP(clientName, oneTimeKey string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	otp, ok := fs.otps[oneTimeKey]
+	if !ok || otp.ClientName != clientName {
+		return nil
+	}
+	delete(fs.otps, oneTimeKey)
+	return fs.saveOTPsLocked()
+}
+
+func (fs *FileStore) PutClient(client Client) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.clients[client.ClientName] = client
+	return fs.saveClientsLocked()
+}
+
+func (fs *FileStore) ListClients() ([]Client, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	out := make([]Client, 0, len(fs.clients))
+	for _, client := range fs.clients {
+		out = append(out, client)
+	}
+	return out, nil
+}
+
+func (fs *FileStore) GetClientByPublicKey(publicKeyPEM string) (Client, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	for _, client := range fs.clients {
+		if client.PublicKey == publicKeyPEM {
+			return client, nil
+		}
+	}
+	return Client{}, ErrNotFound
+}
+
+func (fs *FileStore) GetClientByName(clientName string) (Client, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	client, ok := fs.clients[clientName]
+	if !ok {
+		return Client{}, ErrNotFound
+	}
+	return client, nil
+}
+
+func (fs *FileStore) TouchClient(clientName string, lastUsed time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	client, ok := fs.clients[clientName]
+	if !ok {
+		return nil
+	}
+	client.LastUsed = lastUsed
+	fs.clients[clientName] = client
+	return fs.saveClientsLocked()
+}
+
+func (fs *FileStore) IsClientRegistered(clientName string) (bool, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	client, ok := fs.clients[clientName]
+	if !ok {
+		return false, nil
+	}
+	if client.Revoked {
+		return false, nil
+	}
+	if client.ExpiresAt != nil && time.Now().After(*client.ExpiresAt) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (fs *FileStore) RevokeClient(clientName string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	client, ok := fs.clients[clientName]
+	if !ok {
+		return nil
+	}
+	client.Revoked = true
+	fs.clients[clientName] = client
+	return fs.saveClientsLocked()
+}
+
+func (fs *FileStore) PutSession(session Session) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.sessions[session.Token] = session
+	return nil
+}
+
+func (fs *FileStore) GetSession(token string) (Session, error) {
+	fs.mu.RLock()
+	session, ok := fs.sessions[token]
+	fs.mu.RUnlock()
+
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	if time.Now().After(session.ExpiresAt) {
+		fs.mu.Lock()
+		delete(fs.sessions, token)
+		fs.mu.Unlock()
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (fs *FileStore) ListSessions() ([]Session, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	now := time.Now()
+	out := make([]Session, 0, len(fs.sessions))
+	for _, session := range fs.sessions {
+		if now.After(session.ExpiresAt) {
+			continue
+		}
+		out = append(out, session)
+	}
+	return out, nil
+}
+
+func (fs *FileStore) DeleteSession(token string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.sessions, token)
+	return nil
+}
+
+func (fs *FileStore) CleanupExpired(otpTTL time.Duration) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	now := time.Now()
+	for token, session := range fs.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(fs.sessions, token)
+		}
+	}
+
+	clientsRemoved := false
+	for name, client := range fs.clients {
+		if client.ExpiresAt != nil && now.After(*client.ExpiresAt) {
+			delete(fs.clients, name)
+			clientsRemoved = true
+		}
+	}
+	if clientsRemoved {
+		if err := fs.saveClientsLocked(); err != nil {
+			return err
+		}
+	}
+
+	if otpTTL > 0 {
+		otpsRemoved := false
+		for key, otp := range fs.otps {
+			if now.After(otp.CreatedAt.Add(otpTTL)) {
+				delete(fs.otps, key)
+				otpsRemoved = true
+			}
+		}
+		if otpsRemoved {
+			if err := fs.saveOTPsLocked(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (fs *FileStore) Close() error {
+	return nil
+}
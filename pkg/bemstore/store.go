@@ -0,0 +1,134 @@
+// Package bemstore abstracts BigFix Mobile Enterprise's persistent
+// registration/session state behind a Storage interface, so the server
+// can run with local files (filestore), a single-node embedded database
+// (boltstore), or a shared multi-node store (etcdstore) without any of
+// that choice leaking into cmd/bem's handlers.
+package bemstore
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by the Get* methods when no matching record
+// exists. Callers compare with errors.Is, not a type assertion, so every
+// driver can return it directly.
+var ErrNotFound = errors.New("bemstore: not found")
+
+// OTP is a one-time registration key, mirroring cmd/bem's RegistrationOTP.
+// Extra preserves any fields a driver doesn't recognize (e.g. from a
+// hand-edited drop file written by a newer or older admin tool) so they
+// round-trip rather than being silently dropped.
+type OTP struct {
+	ClientName      string    `json:"client_name"`
+	OneTimeKey      string    `json:"one_time_key"`
+	KeyLifespanDays int       `json:"key_lifespan_days,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	RequestedBy     string    `json:"requested_by,omitempty"`
+	Capabilities    []string  `json:"capabilities,omitempty"`
+	NamePrefix      string    `json:"name_prefix,omitempty"`
+	ValidDuration   int64     `json:"valid_duration,omitempty"`
+	AllowedCIDRs    []string  `json:"allowed_cidrs,omitempty"`
+	KeyAlgorithm    string    `json:"key_algorithm,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Client is a registered device, mirroring cmd/bem's RegisteredClient.
+type Client struct {
+	ClientName      string     `json:"client_name"`
+	PublicKey       string     `json:"public_key"`
+	RegisteredAt    time.Time  `json:"registered_at"`
+	ExpiresAt       *time.Time `json:"expires_at,omitempty"`
+	LastUsed        time.Time  `json:"last_used,omitempty"`
+	KeyLifespanDays int        `json:"key_lifespan_days"`
+	Capabilities    []string   `json:"capabilities,omitempty"`
+
+	// CertificatePEM and CertificateFingerprint are set when this client
+	// was enrolled via the CSR flow (see cmd/bem's issueCertificateForClient)
+	// instead of server-generated raw key material. Fingerprint is the hex
+	// SHA-256 digest of the certificate's DER encoding, for audit logging
+	// and revocation lookups.
+	CertificatePEM         string `json:"certificate_pem,omitempty"`
+	CertificateFingerprint string `json:"certificate_fingerprint,omitempty"`
+
+	// Revoked marks a client as administratively disabled without
+	// deleting its record, so IsClientRegistered rejects it while the
+	// registration history (and any audit trail referencing it) is kept.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// Session is a cookie-based admin session minted from an OTP (see
+// cmd/bem's createAdminSession). Token is the session's own key; the
+// drivers that serialize the record (boltstore, etcdstore) also store
+// it inside the JSON value, so a single Get round-trips it.
+type Session struct {
+	Token        string    `json:"token"`
+	ClientName   string    `json:"client_name"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Capabilities []string  `json:"capabilities,omitempty"`
+}
+
+// Storage is the persistence boundary for registration OTPs, registered
+// clients, and admin sessions. Drivers decide how (and whether) each of
+// these is made durable and/or shared across replicas; callers should
+// not assume anything beyond what the method names promise.
+type Storage interface {
+	// PutOTP stores otp, replacing any existing OTP with the same
+	// ClientName+OneTimeKey pair.
+	PutOTP(otp OTP) error
+	// ListOTPs returns every outstanding OTP.
+	ListOTPs() ([]OTP, error)
+	// GetOTPByKey returns the OTP with the given OneTimeKey, or
+	// ErrNotFound if none exists.
+	GetOTPByKey(oneTimeKey string) (OTP, error)
+	// DeleteOTP removes the OTP matching clientName+oneTimeKey. It is not
+	// an error for no such OTP to exist.
+	DeleteOTP(clientName, oneTimeKey string) error
+
+	// PutClient stores client, replacing any existing record with the
+	// same ClientName.
+	PutClient(client Client) error
+	// ListClients returns every registered client.
+	ListClients() ([]Client, error)
+	// GetClientByPublicKey returns the client whose PublicKey (PEM text)
+	// matches, or ErrNotFound if none exists.
+	GetClientByPublicKey(publicKeyPEM string) (Client, error)
+	// GetClientByName returns the client with the given ClientName, or
+	// ErrNotFound if none exists. Used to resolve a JWS "kid" header to
+	// the public key it should be verified against.
+	GetClientByName(clientName string) (Client, error)
+	// TouchClient updates a client's LastUsed timestamp. It is a no-op if
+	// the client no longer exists.
+	TouchClient(clientName string, lastUsed time.Time) error
+	// IsClientRegistered reports whether an unexpired, unrevoked client
+	// with this name exists.
+	IsClientRegistered(clientName string) (bool, error)
+	// RevokeClient marks clientName as revoked so IsClientRegistered
+	// rejects it, without deleting its record. It is not an error for no
+	// such client to exist.
+	RevokeClient(clientName string) error
+
+	// PutSession stores session, replacing any existing session with the
+	// same Token.
+	PutSession(session Session) error
+	// GetSession returns the session for token, or ErrNotFound if it
+	// doesn't exist or has expired.
+	GetSession(token string) (Session, error)
+	// ListSessions returns every unexpired session.
+	ListSessions() ([]Session, error)
+	// DeleteSession removes a session. It is not an error for no such
+	// session to exist.
+	DeleteSession(token string) error
+	// CleanupExpired removes expired sessions, clients past their
+	// ExpiresAt, and OTPs older than otpTTL (measured from CreatedAt; a
+	// zero otpTTL skips OTP sweeping entirely). It is safe to call
+	// periodically; drivers that expire records lazily or via a lease
+	// may treat parts of this as a no-op.
+	CleanupExpired(otpTTL time.Duration) error
+
+	// Close releases any resources (file handles, DB handles, client
+	// connections) held by the driver.
+	Close() error
+}
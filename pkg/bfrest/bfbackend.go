@@ -0,0 +1,109 @@
+package bfrest
+
+// This file defines the CacheBackend abstraction behind each
+// BigFixServerCache's hot tier. The historical behavior - an unbounded
+// in-memory sync.Map - is just the default implementation (memoryBackend).
+// Alternate backends (fsBackend, redisBackend, badgerBackend) let a
+// CacheItem survive a process restart, or be shared across multiple bem
+// instances, without touching any of the eviction/refresh logic in
+// bfcache.go.
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// CacheBackend stores CacheItems for a single BigFixServerCache, keyed by
+// the request URL. Implementations must be safe for concurrent use.
+type CacheBackend interface {
+	// Get returns the item stored for key, or (nil, false) if absent.
+	Get(key string) (*CacheItem, bool)
+	// Set stores item under key, replacing any existing value.
+	Set(key string, item *CacheItem)
+	// Delete removes key, if present. It is a no-op otherwise.
+	Delete(key string)
+	// Range calls fn for every (key, item) pair, stopping early if fn
+	// returns false. Iteration order is unspecified.
+	Range(fn func(key string, item *CacheItem) bool)
+}
+
+// BackendConfig selects and configures the CacheBackend a server's cache
+// uses, passed to AddServerWithBackend. The zero value selects the
+// in-memory backend (Driver == "").
+type BackendConfig struct {
+	// Driver is one of "" / "memory" (default), "fs", "redis", or
+	// "badger".
+	Driver string
+
+	// FSDir is the root directory used by the "fs" driver. Each server
+	// gets its own subdirectory, sharded like the disk-spill tier (see
+	// bfdisktier.go).
+	FSDir string
+
+	// RedisAddr, RedisPassword, and RedisDB configure the "redis"
+	// driver (see github.com/redis/go-redis/v9's Options). Items are
+	// stored with a TTL aligned to their MaxAge.
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+
+	// BadgerDir is the root directory used by the "badger" driver. Each
+	// server gets its own embedded database under this directory.
+	BadgerDir string
+}
+
+// NewCacheBackend constructs the CacheBackend selected by cfg, namespaced
+// under prefix (the server's base URL) so multiple servers can share one
+// Redis instance or one BadgerDir without key collisions.
+func NewCacheBackend(cfg BackendConfig, prefix string) (CacheBackend, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "", "memory":
+		return newMemoryBackend(), nil
+	case "fs":
+		return newFSBackend(cfg.FSDir, prefix)
+	case "redis":
+		return newRedisBackend(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, prefix)
+	case "badger":
+		return newBadgerBackend(cfg.BadgerDir, prefix)
+	default:
+		return nil, fmt.Errorf("unknown cache backend driver %q", cfg.Driver)
+	}
+}
+
+// memoryBackend is the historical CacheMap behavior: an unbounded
+// in-memory sync.Map. It is the default backend.
+type memoryBackend struct {
+	m sync.Map
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{}
+}
+
+func (b *memoryBackend) Get(key string) (*CacheItem, bool) {
+	value, ok := b.m.Load(key)
+	if !ok {
+		return nil, false
+	}
+	item, ok := value.(*CacheItem)
+	return item, ok
+}
+
+func (b *memoryBackend) Set(key string, item *CacheItem) {
+	b.m.Store(key, item)
+}
+
+func (b *memoryBackend) Delete(key string) {
+	b.m.Delete(key)
+}
+
+func (b *memoryBackend) Range(fn func(key string, item *CacheItem) bool) {
+	b.m.Range(func(k, v interface{}) bool {
+		item, ok := v.(*CacheItem)
+		if !ok {
+			return true
+		}
+		return fn(k.(string), item)
+	})
+}
@@ -0,0 +1,87 @@
+package bfrest
+
+// badgerBackend stores CacheItems in an embedded BadgerDB database, giving
+// a single bem instance a persistent cache across restarts without
+// depending on an external service like Redis.
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type badgerBackend struct {
+	db *badger.DB
+}
+
+func newBadgerBackend(dir, prefix string) (*badgerBackend, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("badger cache backend requires a directory")
+	}
+
+	opts := badger.DefaultOptions(filepath.Join(dir, hashHex(prefix))).WithLogger(nil)
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("badger cache backend: %w", err)
+	}
+	return &badgerBackend{db: db}, nil
+}
+
+func (b *badgerBackend) Get(key string) (*CacheItem, bool) {
+	var item CacheItem
+	err := b.db.View(func(txn *badger.Txn) error {
+		entry, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		return entry.Value(func(val []byte) error {
+			return json.Unmarshal(val, &item)
+		})
+	})
+	if err != nil {
+		return nil, false
+	}
+	return &item, true
+}
+
+func (b *badgerBackend) Set(key string, item *CacheItem) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	b.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), data)
+	})
+}
+
+func (b *badgerBackend) Delete(key string) {
+	b.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+}
+
+func (b *badgerBackend) Range(fn func(key string, item *CacheItem) bool) {
+	b.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			entry := it.Item()
+
+			var item CacheItem
+			err := entry.Value(func(val []byte) error {
+				return json.Unmarshal(val, &item)
+			})
+			if err != nil {
+				continue
+			}
+
+			if !fn(string(entry.Key()), &item) {
+				return nil
+			}
+		}
+		return nil
+	})
+}
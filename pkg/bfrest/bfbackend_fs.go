@@ -0,0 +1,99 @@
+package bfrest
+
+// fsBackend persists CacheItems as individual JSON files, sharded the
+// same way as the disk-spill tier (see bfdisktier.go's diskPath), so a
+// server's cache survives a process restart without needing an external
+// service. It reuses diskEnvelope for its on-disk format.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type fsBackend struct {
+	dir string
+}
+
+func newFSBackend(dir, prefix string) (*fsBackend, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("fs cache backend requires a directory")
+	}
+
+	root := filepath.Join(dir, hashHex(prefix))
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("fs cache backend: %w", err)
+	}
+	return &fsBackend{dir: root}, nil
+}
+
+func hashHex(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func (b *fsBackend) path(key string) string {
+	keyHash := hashHex(key)
+	return filepath.Join(b.dir, keyHash[:2], keyHash+".json")
+}
+
+func (b *fsBackend) Get(key string) (*CacheItem, bool) {
+	data, err := os.ReadFile(b.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var envelope diskEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Item == nil {
+		return nil, false
+	}
+	return envelope.Item, true
+}
+
+func (b *fsBackend) Set(key string, item *CacheItem) {
+	path := b.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(diskEnvelope{URL: key, Item: item})
+	if err != nil {
+		return
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
+
+func (b *fsBackend) Delete(key string) {
+	os.Remove(b.path(key))
+}
+
+func (b *fsBackend) Range(fn func(key string, item *CacheItem) bool) {
+	filepath.Walk(b.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info == nil || info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		var envelope diskEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil || envelope.Item == nil {
+			return nil
+		}
+
+		if !fn(envelope.URL, envelope.Item) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+}
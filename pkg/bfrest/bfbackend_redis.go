@@ -0,0 +1,98 @@
+package bfrest
+
+// redisBackend stores CacheItems in a shared Redis instance, JSON-encoded,
+// with a TTL aligned to each item's MaxAge. This lets multiple bem
+// instances share one cache, and survives any single instance's restart.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type redisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisBackend(addr, password string, db int, prefix string) (*redisBackend, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("redis cache backend requires an address")
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("redis cache backend: %w", err)
+	}
+
+	return &redisBackend{client: client, prefix: prefix + ":"}, nil
+}
+
+func (b *redisBackend) redisKey(key string) string {
+	return b.prefix + key
+}
+
+func (b *redisBackend) Get(key string) (*CacheItem, bool) {
+	data, err := b.client.Get(context.Background(), b.redisKey(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	var item CacheItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, false
+	}
+	return &item, true
+}
+
+func (b *redisBackend) Set(key string, item *CacheItem) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+
+	// Align the Redis TTL with MaxAge so an unreachable entry (e.g. one
+	// this instance never re-reads) still expires on its own. Extend it
+	// a little so a slow refresh cycle doesn't race Redis into expiring
+	// the item a moment before bfcache.go would have.
+	ttl := time.Duration(item.MaxAge+30) * time.Second
+	b.client.Set(context.Background(), b.redisKey(key), data, ttl)
+}
+
+func (b *redisBackend) Delete(key string) {
+	b.client.Del(context.Background(), b.redisKey(key))
+}
+
+func (b *redisBackend) Range(fn func(key string, item *CacheItem) bool) {
+	ctx := context.Background()
+	iter := b.client.Scan(ctx, 0, b.prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		redisKey := iter.Val()
+
+		data, err := b.client.Get(ctx, redisKey).Bytes()
+		if err != nil {
+			continue
+		}
+
+		var item CacheItem
+		if err := json.Unmarshal(data, &item); err != nil {
+			continue
+		}
+
+		key := strings.TrimPrefix(redisKey, b.prefix)
+		if !fn(key, &item) {
+			return
+		}
+	}
+}
@@ -10,20 +10,76 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"log/slog"
 	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest/metrics"
+	"golang.org/x/sync/singleflight"
 )
 
 // BigFixCache is a cache of BigFix servers and their data.
 // It is a singleton that is accessed by multiple goroutines.
 // It contains a map of BigFixServerCache instances.
+//
+// By default the cache is a single unbounded hot tier (the historical
+// behavior). Setting HotEntries and/or HotBytes turns each server's
+// CacheMap into a bounded LRU: entries evicted from the hot tier are
+// spilled to DiskDir (if configured) and promoted back on the next Get.
 type BigFixCache struct {
 	ServerCache      *sync.Map
 	MaxAge           uint64
 	MaxCacheLifetime uint64 // Maximum lifetime for any cache item in seconds
+	Debug            int    // non-zero enables verbose cache tracing to stderr
+
+	HotEntries int    // max hot-tier entries per server, 0 = unbounded
+	HotBytes   int64  // max hot-tier bytes (sum of Json lengths) per server, 0 = unbounded
+	DiskDir    string // directory for the disk-backed tier, "" disables it
+	DiskBytes  int64  // byte budget setting for the disk tier, 0 = unbounded; nothing enforces it: the janitor removes only files older than MaxCacheLifetime
+
+	// MaxTotalBytes caps the sum of every server's hot-tier bytes across
+	// the whole cache, on top of (not instead of) each server's own
+	// HotBytes budget. 0 = unbounded. Enforced the same way as HotBytes:
+	// least-recently-used entries are evicted, probation queue first,
+	// but the candidate is chosen across all servers rather than just
+	// the one that just grew.
+	MaxTotalBytes int64
+
+	// MaxPayloadSize caps how large a server's raw response body may be
+	// before it's admitted to the cache, in bytes. 0 = unbounded. A
+	// BigFixServerCache's own MaxPayloadSize, if non-zero, overrides this
+	// default for that server. Oversized responses are still returned to
+	// the caller, just never stored - see retrieveBigFixData.
+	MaxPayloadSize uint64
+
+	// StaleWhileRevalidate, if non-zero, lets Get serve an item for this
+	// many extra seconds past its MaxAge while refreshing it
+	// asynchronously in the background, instead of blocking the caller
+	// on a synchronous refetch (RFC 5861). A BigFixServerCache's own
+	// StaleWhileRevalidate, if non-zero, overrides this default. 0
+	// disables it, matching the historical behavior.
+	StaleWhileRevalidate uint64
+
+	// StaleIfError, if non-zero, lets Get serve an item for this many
+	// extra seconds past its MaxAge when refreshing it fails (upstream
+	// error, pool exhaustion, timeout), instead of returning the error
+	// to the caller (RFC 5861). A BigFixServerCache's own StaleIfError,
+	// if non-zero, overrides this default. 0 disables it.
+	StaleIfError uint64
+
+	// OnEvict, if set, is called whenever an item is pushed out of the
+	// hot tier (by LRU pressure, not by expiry). It runs synchronously
+	// with the eviction, so it should not block.
+	OnEvict func(serverName, url string, item *CacheItem)
+
+	// events fans out CacheEvents to anything subscribed via Subscribe
+	// (e.g. the /watch WebSocket endpoint). Its zero value is ready to
+	// use.
+	events eventBus
 }
 
 // BigFixServerCache represents a cache for storing one BigFix
@@ -33,8 +89,38 @@ type BigFixServerCache struct {
 	ServerUser string
 	ServerPass string
 	cpool      *Pool
-	CacheMap   *sync.Map
+	CacheMap   CacheBackend
 	MaxAge     uint64
+
+	// MaxPayloadSize overrides BigFixCache.MaxPayloadSize for this server
+	// alone. 0 means "inherit the cache's default".
+	MaxPayloadSize uint64
+
+	// StaleWhileRevalidate and StaleIfError override BigFixCache's
+	// defaults for this server alone. 0 means "inherit the cache's
+	// default".
+	StaleWhileRevalidate uint64
+	StaleIfError         uint64
+
+	lru             *lruTracker
+	hotBytes        int64 // atomic: running total of Json bytes held in the hot tier
+	EvictionCount   uint64
+	SkippedPayloads uint64 // atomic: responses rejected by MaxPayloadSize and served uncached
+
+	// refreshGroup coalesces concurrent misses/refreshes for the same
+	// URL on this server into a single upstream request, so a burst of
+	// callers hitting a cold or expired entry (e.g. PopulateCoreTypes's
+	// fan-out of goroutines, or N mobile clients polling the same
+	// dashboard query) doesn't stampede the BigFix server.
+	refreshGroup singleflight.Group
+
+	// RefreshRequests counts every call into refreshGroup; ActualFetches
+	// counts only the ones that actually ran the fetch closure (one per
+	// coalesced group). The difference is how many callers were served
+	// from someone else's in-flight fetch instead of making their own -
+	// see CacheStats.StampedeSuppressed.
+	RefreshRequests uint64 // atomic
+	ActualFetches   uint64 // atomic
 }
 
 // CacheItem represents the result of a single BigFix GET result
@@ -51,6 +137,31 @@ type CacheItem struct {
 	MaxAge      uint64
 	BaseMaxAge  uint64
 	ContentHash string
+	HitCount    uint64 // number of times this item was returned as a cache hit
+	MissCount   uint64 // number of times this item was (re)fetched from the server
+
+	// ETag and LastModified, when the server supplied them, are replayed
+	// as If-None-Match/If-Modified-Since on the next refresh so an
+	// unchanged resource costs a 304 instead of a full body transfer.
+	ETag         string
+	LastModified string
+
+	// HasServerMaxAge records that BaseMaxAge came from the server's own
+	// Cache-Control/Expires headers rather than the server cache's
+	// configured MaxAge, so future resets keep honoring it.
+	HasServerMaxAge bool
+
+	// StaleWhileRevalidate and StaleIfError are snapshotted from the
+	// server's configuration when this item was (re)fetched, in seconds
+	// past MaxAge, implementing RFC 5861 semantics in Get: 0 disables
+	// each independently.
+	StaleWhileRevalidate uint64
+	StaleIfError         uint64
+
+	// ServedStale records that this particular response was returned
+	// past its MaxAge under stale-while-revalidate or stale-if-error,
+	// so callers that care (metrics, admin introspection) can tell.
+	ServedStale bool
 }
 
 var cacheInstance *BigFixCache
@@ -93,6 +204,20 @@ func ResetCache() {
 // The maxAge parameter specifies the cache expiration time in seconds for this server.
 // Returns the updated BigFixCache instance and an error if the server cache already exists.
 func (cache *BigFixCache) AddServer(url, username, passwd string, poolSize int, maxAge uint64) (*BigFixCache, error) {
+	return cache.AddServerWithTLS(url, username, passwd, poolSize, maxAge, nil)
+}
+
+// AddServerWithTLS behaves like AddServer but uses tlsOpts to control
+// certificate verification and optional mutual TLS for the server's
+// connection pool. A nil tlsOpts is equivalent to AddServer.
+func (cache *BigFixCache) AddServerWithTLS(url, username, passwd string, poolSize int, maxAge uint64, tlsOpts *TLSOptions) (*BigFixCache, error) {
+	return cache.AddServerWithBackend(url, username, passwd, poolSize, maxAge, tlsOpts, BackendConfig{})
+}
+
+// AddServerWithBackend behaves like AddServerWithTLS but also selects the
+// CacheBackend backing the server's hot tier (see BackendConfig). A zero
+// BackendConfig is equivalent to AddServerWithTLS, i.e. an in-memory cache.
+func (cache *BigFixCache) AddServerWithBackend(url, username, passwd string, poolSize int, maxAge uint64, tlsOpts *TLSOptions, backendCfg BackendConfig) (*BigFixCache, error) {
 	baseURL := getBaseUrl(url)
 
 	fmt.Fprintf(os.Stderr, "Get URL: %s\n", url)
@@ -101,7 +226,7 @@ func (cache *BigFixCache) AddServer(url, username, passwd string, poolSize int,
 
 	// If the BigFixServerCache is not found...
 	if !err {
-		newpool, _ := NewPool(baseURL, username, passwd, poolSize)
+		newpool, _ := NewPoolWithTLS(baseURL, username, passwd, poolSize, tlsOpts)
 
 		// Use server-specific maxAge, or fall back to cache default if not specified
 		serverMaxAge := maxAge
@@ -109,14 +234,20 @@ func (cache *BigFixCache) AddServer(url, username, passwd string, poolSize int,
 			serverMaxAge = cache.MaxAge
 		}
 
+		backend, err := NewCacheBackend(backendCfg, baseURL)
+		if err != nil {
+			return nil, err
+		}
+
 		scInstance := &BigFixServerCache{
 			ServerName: baseURL,
 			cpool:      newpool,
 			MaxAge:     serverMaxAge,
-			CacheMap:   &sync.Map{},
+			CacheMap:   backend,
+			lru:        newLRUTracker(),
 		}
 
-		fmt.Fprintf(os.Stderr, "Added server %s with MaxAge: %d seconds\n", baseURL, serverMaxAge)
+		fmt.Fprintf(os.Stderr, "Added server %s with MaxAge: %d seconds, cache backend: %q\n", baseURL, serverMaxAge, backendCfg.Driver)
 
 		cache.ServerCache.Store(baseURL, scInstance)
 		// Reload scValue with the newly created cache
@@ -127,6 +258,109 @@ func (cache *BigFixCache) AddServer(url, username, passwd string, poolSize int,
 	return nil, fmt.Errorf("server cache %s already exists", baseURL)
 }
 
+// SetMaxPayloadSize overrides MaxPayloadSize for a single already-added
+// server (any URL belonging to that server works), without touching the
+// cache-wide default used by every other server. It returns an error if
+// no server cache exists yet for url.
+func (cache *BigFixCache) SetMaxPayloadSize(url string, maxPayloadSize uint64) error {
+	baseURL := getBaseUrl(url)
+
+	scValue, ok := cache.ServerCache.Load(baseURL)
+	if !ok {
+		return fmt.Errorf("server cache does not exist for %s", baseURL)
+	}
+
+	sc, _ := scValue.(*BigFixServerCache)
+	sc.MaxPayloadSize = maxPayloadSize
+	return nil
+}
+
+// SetStaleWhileRevalidate overrides StaleWhileRevalidate for a single
+// already-added server (any URL belonging to that server works), without
+// touching the cache-wide default used by every other server. It returns
+// an error if no server cache exists yet for url.
+func (cache *BigFixCache) SetStaleWhileRevalidate(url string, seconds uint64) error {
+	baseURL := getBaseUrl(url)
+
+	scValue, ok := cache.ServerCache.Load(baseURL)
+	if !ok {
+		return fmt.Errorf("server cache does not exist for %s", baseURL)
+	}
+
+	sc, _ := scValue.(*BigFixServerCache)
+	sc.StaleWhileRevalidate = seconds
+	return nil
+}
+
+// SetStaleIfError overrides StaleIfError for a single already-added
+// server (any URL belonging to that server works), without touching the
+// cache-wide default used by every other server. It returns an error if
+// no server cache exists yet for url.
+func (cache *BigFixCache) SetStaleIfError(url string, seconds uint64) error {
+	baseURL := getBaseUrl(url)
+
+	scValue, ok := cache.ServerCache.Load(baseURL)
+	if !ok {
+		return fmt.Errorf("server cache does not exist for %s", baseURL)
+	}
+
+	sc, _ := scValue.(*BigFixServerCache)
+	sc.StaleIfError = seconds
+	return nil
+}
+
+// PoolFor returns the connection pool backing the server that owns url,
+// for callers (like the /ws/query streaming handler) that need a raw
+// BFConnection rather than a cached, fully-buffered Get result.
+func (cache *BigFixCache) PoolFor(urlStr string) (*Pool, error) {
+	baseURL := getBaseUrl(urlStr)
+
+	scValue, ok := cache.ServerCache.Load(baseURL)
+	if !ok {
+		return nil, fmt.Errorf("server cache does not exist for %s", baseURL)
+	}
+
+	sc, _ := scValue.(*BigFixServerCache)
+	return sc.cpool, nil
+}
+
+// RemoveServer drains url's connection pool, flushes its CacheMap, and
+// removes the server from the cache entirely. It is the runtime
+// counterpart to AddServer/AddServerWithBackend, for admin endpoints
+// that let an operator reconfigure servers without a restart. Returns
+// an error if no server cache exists for url.
+func (cache *BigFixCache) RemoveServer(urlStr string) error {
+	baseURL := getBaseUrl(urlStr)
+
+	scValue, ok := cache.ServerCache.LoadAndDelete(baseURL)
+	if !ok {
+		return fmt.Errorf("server cache does not exist for %s", baseURL)
+	}
+
+	sc, _ := scValue.(*BigFixServerCache)
+
+	sc.cpool.Close()
+
+	var keys []string
+	sc.CacheMap.Range(func(key string, _ *CacheItem) bool {
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		sc.CacheMap.Delete(key)
+	}
+
+	return nil
+}
+
+// NormalizeServerURL returns the base URL (scheme+host+port) used to key
+// a server in BigFixCache.ServerCache, for callers (like the runtime
+// /admin/servers endpoints) that need to match an operator-supplied URL
+// against the cache without duplicating getBaseUrl's parsing.
+func NormalizeServerURL(fullURL string) string {
+	return getBaseUrl(fullURL)
+}
+
 // getBaseUrl returns the base URL extracted from the given full URL.
 // It parses the full URL and extracts the scheme, host, and port (if present).
 // The base URL is then constructed by combining the scheme, host, and port.
@@ -189,25 +423,58 @@ func (cache *BigFixCache) Get(url string) (*CacheItem, error) {
 	// requested URL and if it is not expired
 
 	// If the result doesn't exist or is too old, pull it from the server
-	value, ok := sc.CacheMap.Load(url)
-
-	var cm *CacheItem
+	cm, ok := sc.CacheMap.Get(url)
 
 	if !ok {
-		// Cache miss - first time accessing this URL
-
-		cm, err := retrieveBigFixData(url, sc)
-		if err != nil {
-			return nil, err
+		// Not in the hot tier. Before going to the server, check whether
+		// it was previously spilled to the disk tier and promote it back
+		// if so.
+		if diskItem, found := loadFromDisk(cache.DiskDir, sc.ServerName, url, cache.MaxCacheLifetime); found {
+			removeFromDisk(cache.DiskDir, sc.ServerName, url)
+			cache.storeHot(sc, url, diskItem)
+			cm = diskItem
+			ok = true
 		}
-		sc.CacheMap.Store(url, cm)
-		return cm, nil
 	}
 
-	cm, ok = value.(*CacheItem)
+	maxPayloadSize := sc.MaxPayloadSize
+	if maxPayloadSize == 0 {
+		maxPayloadSize = cache.MaxPayloadSize
+	}
+
+	staleWhileRevalidate := sc.StaleWhileRevalidate
+	if staleWhileRevalidate == 0 {
+		staleWhileRevalidate = cache.StaleWhileRevalidate
+	}
+	staleIfError := sc.StaleIfError
+	if staleIfError == 0 {
+		staleIfError = cache.StaleIfError
+	}
 
 	if !ok {
-		return nil, fmt.Errorf("type failure loading cache item for %s", url)
+		// Cache miss - first time accessing this URL. No prior item, so
+		// no conditional headers are sent and a 304 can't come back.
+		// Coalesce concurrent misses for the same URL into one fetch.
+		metrics.RecordMiss(sc.ServerName)
+		atomic.AddUint64(&sc.RefreshRequests, 1)
+		v, err, _ := sc.refreshGroup.Do(url, func() (interface{}, error) {
+			atomic.AddUint64(&sc.ActualFetches, 1)
+			cm, _, oversized, err := retrieveBigFixData(url, sc, nil, maxPayloadSize)
+			if err != nil {
+				return nil, err
+			}
+			if oversized {
+				atomic.AddUint64(&sc.SkippedPayloads, 1)
+				return cm, nil
+			}
+			cache.storeHot(sc, url, cm)
+			cache.publishEvent(EventCreated, sc.ServerName, url, cm)
+			return cm, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.(*CacheItem), nil
 	}
 
 	// Check if cache item needs refresh: Json is empty (cleared by GC) or expired
@@ -215,126 +482,447 @@ func (cache *BigFixCache) Get(url string) (*CacheItem, error) {
 	isExpired := time.Now().Unix()-cm.Timestamp > int64(cm.MaxAge)
 	needsRefresh := isEmpty || isExpired
 
-	fmt.Fprintf(os.Stderr, "\n=== CACHE CHECK for %s ===\n", url)
-	fmt.Fprintf(os.Stderr, "  Current state: isEmpty=%v, isExpired=%v, needsRefresh=%v\n", isEmpty, isExpired, needsRefresh)
-	fmt.Fprintf(os.Stderr, "  Current values: Timestamp=%d, MaxAge=%d, BaseMaxAge=%d, JSON length=%d, Hash=%s\n",
-		cm.Timestamp, cm.MaxAge, cm.BaseMaxAge, len(cm.Json), cm.ContentHash[:8])
+	if cache.Debug != 0 {
+		slog.Debug("cache check", "url", url, "is_empty", isEmpty, "is_expired", isExpired,
+			"needs_refresh", needsRefresh, "max_age", cm.MaxAge, "base_max_age", cm.BaseMaxAge,
+			"json_bytes", len(cm.Json))
+	}
 
 	if needsRefresh {
-		fmt.Fprintf(os.Stderr, "  --> Refreshing from server...\n")
+		// RFC 5861 stale-while-revalidate: if a non-empty item is only
+		// stale (not GC-cleared) and within its SWR window, serve it
+		// immediately and kick off the refresh in the background instead
+		// of making the caller wait on it.
+		age := time.Now().Unix() - cm.Timestamp
+		if !isEmpty && staleWhileRevalidate > 0 && age <= int64(cm.MaxAge+staleWhileRevalidate) {
+			metrics.RecordRefresh(sc.ServerName, "stale_while_revalidate")
+			atomic.AddUint64(&sc.RefreshRequests, 1)
+			go func() {
+				sc.refreshGroup.Do(url, func() (interface{}, error) {
+					atomic.AddUint64(&sc.ActualFetches, 1)
+					return cache.refreshFromServer(sc, url, cm, maxPayloadSize, staleWhileRevalidate, staleIfError)
+				})
+			}()
+
+			stale := *cm
+			stale.ServedStale = true
+			stale.StaleWhileRevalidate = staleWhileRevalidate
+			stale.StaleIfError = staleIfError
+			stale.HitCount++
+			sc.lru.touch(url)
+			return &stale, nil
+		}
 
-		// Fetch fresh data from server
-		newItem, err := retrieveBigFixData(url, sc)
+		// Coalesce concurrent refreshes for the same URL into one
+		// upstream request; every caller gets the same resulting item.
+		atomic.AddUint64(&sc.RefreshRequests, 1)
+		v, err, _ := sc.refreshGroup.Do(url, func() (interface{}, error) {
+			atomic.AddUint64(&sc.ActualFetches, 1)
+			return cache.refreshFromServer(sc, url, cm, maxPayloadSize, staleWhileRevalidate, staleIfError)
+		})
 		if err != nil {
 			return nil, err
 		}
+		return v.(*CacheItem), nil
+	}
 
-		fmt.Fprintf(os.Stderr, "  Fresh data retrieved: JSON length=%d, Hash=%s\n", len(newItem.Json), newItem.ContentHash[:8])
+	metrics.RecordHit(sc.ServerName)
 
-		// Determine if content has changed by comparing hashes
-		hashMatches := cm.ContentHash != "" && newItem.ContentHash == cm.ContentHash
-		fmt.Fprintf(os.Stderr, "  Hash comparison: old=%s, new=%s, matches=%v\n",
-			cm.ContentHash[:8], newItem.ContentHash[:8], hashMatches)
+	// Cache hit - return existing valid item
+	cm.HitCount++
+	sc.lru.touch(url)
+	return cm, nil
+}
 
-		var updatedItem *CacheItem
+// refreshFromServer re-fetches (or revalidates) a single URL from the
+// BigFix server and reconciles the result with the prior cache item.
+// It is the body of the needsRefresh branch of Get, pulled into its own
+// method so it can be coalesced through refreshGroup without duplicating
+// the reconciliation logic per caller.
+func (cache *BigFixCache) refreshFromServer(sc *BigFixServerCache, url string, cm *CacheItem, maxPayloadSize uint64, staleWhileRevalidate, staleIfError uint64) (*CacheItem, error) {
+	// Fetch fresh data from server, revalidating against the prior
+	// ETag/Last-Modified (if any) instead of always re-fetching the
+	// full body.
+	newItem, notModified, oversized, err := retrieveBigFixData(url, sc, cm, maxPayloadSize)
+	if err != nil {
+		// RFC 5861 stale-if-error: serve the existing (non-empty) item
+		// rather than a hard error, as long as it's still within its
+		// stale-if-error window. Pool exhaustion, 5xx responses, and
+		// timeouts all surface here as err.
+		age := time.Now().Unix() - cm.Timestamp
+		if cm.Json != "" && staleIfError > 0 && age <= int64(cm.MaxAge+staleIfError) {
+			metrics.RecordRefresh(sc.ServerName, "stale_if_error")
+			stale := *cm
+			stale.ServedStale = true
+			stale.StaleIfError = staleIfError
+			return &stale, nil
+		}
+		return nil, err
+	}
 
-		if hashMatches {
-			// Content unchanged - restore Json (if it was cleared) and extend MaxAge
-			newMaxAge := cm.MaxAge + cm.BaseMaxAge
-			if newMaxAge > cache.MaxCacheLifetime {
-				fmt.Fprintf(os.Stderr, "  MaxAge extension capped: would be %d, capping to %d (MaxCacheLifetime)\n",
-					newMaxAge, cache.MaxCacheLifetime)
-				newMaxAge = cache.MaxCacheLifetime
-			}
+	if notModified {
+		metrics.RecordRefresh(sc.ServerName, "not_modified")
 
-			fmt.Fprintf(os.Stderr, "  HASH MATCHED - Content unchanged!\n")
-			fmt.Fprintf(os.Stderr, "    Extending MaxAge: %d + %d = %d\n", cm.MaxAge, cm.BaseMaxAge, newMaxAge)
-			fmt.Fprintf(os.Stderr, "    Restoring JSON: %d bytes\n", len(newItem.Json))
-
-			// Create updated item with extended MaxAge, restored Json, and same content hash
-			updatedItem = &CacheItem{
-				Timestamp:   time.Now().Unix(),
-				Json:        newItem.Json,
-				MaxAge:      newMaxAge,
-				BaseMaxAge:  cm.BaseMaxAge,
-				ContentHash: cm.ContentHash, // Keep old hash since content matches
-			}
+		newMaxAge := cm.MaxAge + cm.BaseMaxAge
+		if newMaxAge > cache.MaxCacheLifetime {
+			newMaxAge = cache.MaxCacheLifetime
+		}
 
-			fmt.Fprintf(os.Stderr, "  Values to be stored:\n")
-			fmt.Fprintf(os.Stderr, "    Timestamp:   %d (now)\n", updatedItem.Timestamp)
-			fmt.Fprintf(os.Stderr, "    MaxAge:      %d\n", updatedItem.MaxAge)
-			fmt.Fprintf(os.Stderr, "    BaseMaxAge:  %d\n", updatedItem.BaseMaxAge)
-			fmt.Fprintf(os.Stderr, "    JSON length: %d\n", len(updatedItem.Json))
-			fmt.Fprintf(os.Stderr, "    ContentHash: %s\n", updatedItem.ContentHash[:8])
-		} else {
-			fmt.Fprintf(os.Stderr, "  HASH CHANGED - Content has changed!\n")
-			fmt.Fprintf(os.Stderr, "    Resetting MaxAge to BaseMaxAge: %d\n", cm.BaseMaxAge)
-			fmt.Fprintf(os.Stderr, "    Updating hash: %s -> %s\n", cm.ContentHash[:8], newItem.ContentHash[:8])
-
-			// Content changed - store new data with new hash and reset to BaseMaxAge
-			updatedItem = &CacheItem{
-				Timestamp:   time.Now().Unix(),
-				Json:        newItem.Json,
-				MaxAge:      cm.BaseMaxAge, // Reset to base, not newItem.MaxAge
-				BaseMaxAge:  cm.BaseMaxAge,
-				ContentHash: newItem.ContentHash, // Update to new hash
-			}
+		updatedItem := &CacheItem{
+			Timestamp:            time.Now().Unix(),
+			Json:                 cm.Json,
+			MaxAge:               newMaxAge,
+			BaseMaxAge:           cm.BaseMaxAge,
+			ContentHash:          cm.ContentHash,
+			HitCount:             cm.HitCount,
+			MissCount:            cm.MissCount + 1,
+			ETag:                 cm.ETag,
+			LastModified:         cm.LastModified,
+			HasServerMaxAge:      cm.HasServerMaxAge,
+			StaleWhileRevalidate: staleWhileRevalidate,
+			StaleIfError:         staleIfError,
+		}
+		cache.storeHot(sc, url, updatedItem)
+		cache.publishEvent(EventUnchanged, sc.ServerName, url, updatedItem)
+		if cache.Debug != 0 {
+			slog.Debug("cache refresh: not modified", "url", url, "new_max_age", newMaxAge)
+		}
+		return updatedItem, nil
+	}
 
-			fmt.Fprintf(os.Stderr, "  Values to be stored:\n")
-			fmt.Fprintf(os.Stderr, "    Timestamp:   %d (now)\n", updatedItem.Timestamp)
-			fmt.Fprintf(os.Stderr, "    MaxAge:      %d\n", updatedItem.MaxAge)
-			fmt.Fprintf(os.Stderr, "    BaseMaxAge:  %d\n", updatedItem.BaseMaxAge)
-			fmt.Fprintf(os.Stderr, "    JSON length: %d\n", len(updatedItem.Json))
-			fmt.Fprintf(os.Stderr, "    ContentHash: %s\n", updatedItem.ContentHash[:8])
-		}
-
-		// Store the updated item back to cache
-		fmt.Fprintf(os.Stderr, "  --> Calling CacheMap.Store() to save updated item...\n")
-		sc.CacheMap.Store(url, updatedItem)
-		fmt.Fprintf(os.Stderr, "  --> Store completed successfully!\n")
-
-		// Verify the store worked by reading it back
-		verifyValue, verifyOk := sc.CacheMap.Load(url)
-		if verifyOk {
-			verifyItem := verifyValue.(*CacheItem)
-			fmt.Fprintf(os.Stderr, "  VERIFICATION - Read back from cache:\n")
-			fmt.Fprintf(os.Stderr, "    Timestamp:   %d\n", verifyItem.Timestamp)
-			fmt.Fprintf(os.Stderr, "    MaxAge:      %d\n", verifyItem.MaxAge)
-			fmt.Fprintf(os.Stderr, "    BaseMaxAge:  %d\n", verifyItem.BaseMaxAge)
-			fmt.Fprintf(os.Stderr, "    JSON length: %d\n", len(verifyItem.Json))
-			fmt.Fprintf(os.Stderr, "    ContentHash: %s\n", verifyItem.ContentHash[:8])
-		} else {
-			fmt.Fprintf(os.Stderr, "  ERROR: Failed to verify - could not load item back from cache!\n")
-		}
-
-		fmt.Fprintf(os.Stderr, "=== END CACHE CHECK ===\n\n")
+	// Determine if content has changed by comparing hashes
+	hashMatches := cm.ContentHash != "" && newItem.ContentHash == cm.ContentHash
+
+	var updatedItem *CacheItem
+	var result string
+
+	if hashMatches {
+		// Content unchanged - restore Json (if it was cleared) and extend MaxAge
+		newMaxAge := cm.MaxAge + cm.BaseMaxAge
+		if newMaxAge > cache.MaxCacheLifetime {
+			newMaxAge = cache.MaxCacheLifetime
+		}
+
+		// Create updated item with extended MaxAge, restored Json, and same content hash
+		updatedItem = &CacheItem{
+			Timestamp:            time.Now().Unix(),
+			Json:                 newItem.Json,
+			MaxAge:               newMaxAge,
+			BaseMaxAge:           newItem.BaseMaxAge,
+			ContentHash:          cm.ContentHash, // Keep old hash since content matches
+			HitCount:             cm.HitCount,
+			MissCount:            cm.MissCount + 1,
+			ETag:                 newItem.ETag,
+			LastModified:         newItem.LastModified,
+			HasServerMaxAge:      newItem.HasServerMaxAge,
+			StaleWhileRevalidate: staleWhileRevalidate,
+			StaleIfError:         staleIfError,
+		}
+		result = "hash_match"
+	} else {
+		// Content changed - store new data with new hash and reset to BaseMaxAge
+		updatedItem = &CacheItem{
+			Timestamp:            time.Now().Unix(),
+			Json:                 newItem.Json,
+			MaxAge:               newItem.BaseMaxAge, // Reset to base, not the extended value
+			BaseMaxAge:           newItem.BaseMaxAge,
+			ContentHash:          newItem.ContentHash, // Update to new hash
+			HitCount:             cm.HitCount,
+			MissCount:            cm.MissCount + 1,
+			ETag:                 newItem.ETag,
+			LastModified:         newItem.LastModified,
+			HasServerMaxAge:      newItem.HasServerMaxAge,
+			StaleWhileRevalidate: staleWhileRevalidate,
+			StaleIfError:         staleIfError,
+		}
+		result = "hash_changed"
+	}
+	metrics.RecordRefresh(sc.ServerName, result)
+
+	if cache.Debug != 0 {
+		slog.Debug("cache refresh", "url", url, "result", result, "max_age", updatedItem.MaxAge,
+			"json_bytes", len(updatedItem.Json))
+	}
+
+	evType := EventUnchanged
+	if !hashMatches {
+		evType = EventRefreshed
+	}
+
+	if oversized {
+		atomic.AddUint64(&sc.SkippedPayloads, 1)
+		cache.publishEvent(evType, sc.ServerName, url, updatedItem)
 		return updatedItem, nil
 	}
 
-	fmt.Fprintf(os.Stderr, "  --> Cache hit - returning existing item\n")
-	fmt.Fprintf(os.Stderr, "=== END CACHE CHECK ===\n\n")
+	cache.storeHot(sc, url, updatedItem)
+	cache.publishEvent(evType, sc.ServerName, url, updatedItem)
+	return updatedItem, nil
+}
 
-	// Cache hit - return existing valid item
-	return cm, nil
+// storeHot writes item into sc's hot tier, updates LRU order and byte
+// accounting, and evicts the least-recently-used entries if HotEntries
+// or HotBytes is now exceeded.
+func (cache *BigFixCache) storeHot(sc *BigFixServerCache, url string, item *CacheItem) {
+	old, existed := sc.CacheMap.Get(url)
+	sc.CacheMap.Set(url, item)
+	sc.lru.touch(url)
+
+	delta := int64(len(item.Json))
+	if existed {
+		delta -= int64(len(old.Json))
+	}
+	atomic.AddInt64(&sc.hotBytes, delta)
+	metrics.SetItems(sc.ServerName, sc.lru.len())
+	metrics.SetBytes(sc.ServerName, atomic.LoadInt64(&sc.hotBytes))
+
+	cache.enforceHotLimits(sc)
+	cache.enforceTotalBudget()
+}
+
+// enforceHotLimits evicts the least-recently-used entries from sc's hot
+// tier until it satisfies HotEntries and HotBytes. It is a no-op unless
+// at least one of those limits is configured.
+func (cache *BigFixCache) enforceHotLimits(sc *BigFixServerCache) {
+	if cache.HotEntries <= 0 && cache.HotBytes <= 0 {
+		return
+	}
+
+	for {
+		overEntries := cache.HotEntries > 0 && sc.lru.len() > cache.HotEntries
+		overBytes := cache.HotBytes > 0 && atomic.LoadInt64(&sc.hotBytes) > cache.HotBytes
+		if !overEntries && !overBytes {
+			return
+		}
+
+		oldest, ok := sc.lru.oldest()
+		if !ok {
+			return
+		}
+		cache.evictHot(sc, oldest)
+	}
+}
+
+// enforceTotalBudget evicts the globally least-recently-used entry,
+// probation queues first, across every server until the cache's summed
+// hot-tier bytes satisfies MaxTotalBytes. It is a no-op unless
+// MaxTotalBytes is configured. This runs in addition to (not instead
+// of) each server's own HotBytes budget.
+func (cache *BigFixCache) enforceTotalBudget() {
+	if cache.MaxTotalBytes <= 0 {
+		return
+	}
+
+	for cache.totalHotBytes() > cache.MaxTotalBytes {
+		victimSC, victimURL, ok := cache.oldestAcrossServers()
+		if !ok {
+			return
+		}
+		cache.evictHot(victimSC, victimURL)
+	}
+}
+
+// totalHotBytes sums hotBytes across every server's hot tier.
+func (cache *BigFixCache) totalHotBytes() int64 {
+	var total int64
+	cache.ServerCache.Range(func(_, value interface{}) bool {
+		sc, ok := value.(*BigFixServerCache)
+		if !ok {
+			return true
+		}
+		total += atomic.LoadInt64(&sc.hotBytes)
+		return true
+	})
+	return total
+}
+
+// oldestAcrossServers finds the single least-recently-used entry across
+// every server, preferring any server's probation-queue candidate over
+// any protected-queue candidate, then the oldest CacheItem timestamp
+// among those candidates.
+func (cache *BigFixCache) oldestAcrossServers() (*BigFixServerCache, string, bool) {
+	var bestSC *BigFixServerCache
+	var bestURL string
+	var bestTimestamp int64
+	var bestProtected bool
+	found := false
+
+	cache.ServerCache.Range(func(_, value interface{}) bool {
+		sc, ok := value.(*BigFixServerCache)
+		if !ok {
+			return true
+		}
+		url, protected, ok := sc.lru.oldestWithQueue()
+		if !ok {
+			return true
+		}
+		item, ok := sc.CacheMap.Get(url)
+		if !ok {
+			return true
+		}
+
+		switch {
+		case !found:
+			bestSC, bestURL, bestTimestamp, bestProtected, found = sc, url, item.Timestamp, protected, true
+		case protected != bestProtected:
+			// A probation candidate always beats a protected one,
+			// regardless of timestamp, so the cross-server pick honors
+			// the same "probation first" ordering each server's own
+			// queue already enforces.
+			if !protected {
+				bestSC, bestURL, bestTimestamp, bestProtected = sc, url, item.Timestamp, protected
+			}
+		case item.Timestamp < bestTimestamp:
+			bestSC, bestURL, bestTimestamp, bestProtected = sc, url, item.Timestamp, protected
+		}
+		return true
+	})
+
+	return bestSC, bestURL, found
+}
+
+// evictHot removes url from sc's hot tier, spills it to the disk tier
+// (if configured), and invokes cache.OnEvict (if set).
+func (cache *BigFixCache) evictHot(sc *BigFixServerCache, url string) {
+	item, ok := sc.CacheMap.Get(url)
+	sc.CacheMap.Delete(url)
+	sc.lru.remove(url)
+
+	if !ok {
+		return
+	}
+
+	atomic.AddInt64(&sc.hotBytes, -int64(len(item.Json)))
+	atomic.AddUint64(&sc.EvictionCount, 1)
+	metrics.RecordEviction(sc.ServerName)
+	metrics.SetItems(sc.ServerName, sc.lru.len())
+	metrics.SetBytes(sc.ServerName, atomic.LoadInt64(&sc.hotBytes))
+	cache.publishEvent(EventExpired, sc.ServerName, url, item)
+
+	if cache.OnEvict != nil {
+		cache.OnEvict(sc.ServerName, url, item)
+	}
+	spillToDisk(cache.DiskDir, sc.ServerName, url, item)
+}
+
+// CacheStats summarizes cache activity across all servers, as returned
+// by Stats().
+type CacheStats struct {
+	Hits            uint64
+	Misses          uint64
+	Evictions       uint64
+	HotBytes        int64
+	HotEntries      int
+	SkippedPayloads uint64 // responses rejected by MaxPayloadSize and served uncached
+
+	// StampedeSuppressed counts requests that were coalesced onto
+	// another caller's in-flight fetch by refreshGroup instead of
+	// making their own upstream call (RefreshRequests - ActualFetches,
+	// summed across every server).
+	StampedeSuppressed uint64
+}
+
+// Stats aggregates hit/miss/eviction counters and the current hot-tier
+// footprint across every server in the cache.
+func (cache *BigFixCache) Stats() CacheStats {
+	var stats CacheStats
+
+	cache.ServerCache.Range(func(_, value interface{}) bool {
+		sc, ok := value.(*BigFixServerCache)
+		if !ok {
+			return true
+		}
+
+		stats.Evictions += atomic.LoadUint64(&sc.EvictionCount)
+		stats.HotBytes += atomic.LoadInt64(&sc.hotBytes)
+		stats.HotEntries += sc.lru.len()
+		stats.SkippedPayloads += atomic.LoadUint64(&sc.SkippedPayloads)
+		stats.StampedeSuppressed += atomic.LoadUint64(&sc.RefreshRequests) - atomic.LoadUint64(&sc.ActualFetches)
+
+		sc.CacheMap.Range(func(_ string, item *CacheItem) bool {
+			stats.Hits += item.HitCount
+			stats.Misses += item.MissCount
+			return true
+		})
+
+		return true
+	})
+
+	return stats
+}
+
+// Purge clears every server's hot tier and, if DiskDir is configured,
+// removes every file in the disk tier. It is intended for tests and
+// admin tooling, not normal request handling.
+func (cache *BigFixCache) Purge() {
+	cache.ServerCache.Range(func(_, value interface{}) bool {
+		sc, ok := value.(*BigFixServerCache)
+		if !ok {
+			return true
+		}
+
+		var keys []string
+		sc.CacheMap.Range(func(key string, _ *CacheItem) bool {
+			keys = append(keys, key)
+			return true
+		})
+		for _, key := range keys {
+			sc.CacheMap.Delete(key)
+		}
+		sc.lru = newLRUTracker()
+		atomic.StoreInt64(&sc.hotBytes, 0)
+
+		return true
+	})
+
+	if cache.DiskDir != "" {
+		os.RemoveAll(cache.DiskDir)
+	}
 }
 
 // retrieveBigFixData retrieves BigFix data from the specified URL and returns a CacheItem containing the raw XML and JSON representation of the data.
-// It acquires a connection from the BigFixServerCache connection pool, makes a GET request to the URL, and unmarshals the XML response into either a BESAPI or BES struct.
+// It acquires a connection from the BigFixServerCache connection pool, makes a conditional GET request to the URL (replaying prior's
+// ETag/Last-Modified, if any), and unmarshals the XML response into either a BESAPI or BES struct.
 // The JSON representation of the struct is then marshaled and returned as part of the CacheItem.
+// If the server responds 304 Not Modified, the second return value is true and the CacheItem is nil; the caller is expected to
+// extend the existing entry itself rather than replace it.
+// If the raw response body exceeds maxPayloadSize (0 = unbounded), the third return value is true: the CacheItem is still
+// populated and usable, but the caller must not store it, to avoid holding oversized payloads in the cache indefinitely.
 // If any errors occur during the process, the acquired connection is released and the error is returned.
-func retrieveBigFixData(urlStr string, sc *BigFixServerCache) (*CacheItem, error) {
+func retrieveBigFixData(urlStr string, sc *BigFixServerCache, prior *CacheItem, maxPayloadSize uint64) (*CacheItem, bool, bool, error) {
 	conn, err := sc.cpool.Acquire()
 
 	if err != nil {
 		fmt.Printf("For URL %s\nError acquiring connection: %s\n\n", urlStr, err)
-		return nil, err
+		return nil, false, false, err
+	}
+
+	var ifNoneMatch, ifModifiedSince string
+	if prior != nil {
+		ifNoneMatch = prior.ETag
+		ifModifiedSince = prior.LastModified
 	}
 
-	rawResponse, err := conn.Get(urlStr)
+	resp, err := conn.GetConditional(urlStr, ifNoneMatch, ifModifiedSince)
 
 	if err != nil {
+		sc.cpool.RecordFailure()
 		sc.cpool.Release(conn)
-		return nil, err
+		return nil, false, false, err
+	}
+	sc.cpool.RecordSuccess()
+
+	if resp.NotModified() {
+		sc.cpool.Release(conn)
+		return nil, true, false, nil
+	}
+
+	rawResponse := resp.Body
+	oversized := maxPayloadSize > 0 && uint64(len(rawResponse)) > maxPayloadSize
+	metrics.ObservePayloadBytes(sc.ServerName, len(rawResponse))
+	maxAge, hasServerMaxAge := serverMaxAge(resp.CacheControl, resp.Expires)
+	if !hasServerMaxAge {
+		maxAge = sc.MaxAge
 	}
 
 	// Check if this is an /api/query endpoint with JSON output format
@@ -345,7 +933,7 @@ func retrieveBigFixData(urlStr string, sc *BigFixServerCache) (*CacheItem, error
 			// Check for output=json or format=json parameters
 			outputFormat := queryParams.Get("output")
 			formatParam := queryParams.Get("format")
-			
+
 			if outputFormat == "json" || formatParam == "json" {
 				// For JSON format requests, pass through the JSON response directly
 				hash := md5.Sum([]byte(rawResponse))
@@ -353,12 +941,15 @@ func retrieveBigFixData(urlStr string, sc *BigFixServerCache) (*CacheItem, error
 
 				sc.cpool.Release(conn)
 				return &CacheItem{
-					Timestamp:   time.Now().Unix(),
-					Json:        rawResponse,
-					MaxAge:      sc.MaxAge,
-					BaseMaxAge:  sc.MaxAge,
-					ContentHash: contentHash,
-				}, nil
+					Timestamp:       time.Now().Unix(),
+					Json:            rawResponse,
+					MaxAge:          maxAge,
+					BaseMaxAge:      maxAge,
+					ContentHash:     contentHash,
+					ETag:            resp.ETag,
+					LastModified:    resp.LastModified,
+					HasServerMaxAge: hasServerMaxAge,
+				}, false, oversized, nil
 			}
 		}
 	}
@@ -372,29 +963,29 @@ func retrieveBigFixData(urlStr string, sc *BigFixServerCache) (*CacheItem, error
 		err = xml.Unmarshal(([]byte)(rawResponse), &besapi)
 		if err != nil {
 			sc.cpool.Release(conn)
-fmt.Printf("DEBUG.BESAPI: for url [%s]\nxml.Unmarshal failed, err [%s]\nRaw result [%s]\n------------\n\n", urlStr, err, rawResponse)
-			return nil, err
+			fmt.Printf("DEBUG.BESAPI: for url [%s]\nxml.Unmarshal failed, err [%s]\nRaw result [%s]\n------------\n\n", urlStr, err, rawResponse)
+			return nil, false, false, err
 		}
 
 		jsonValue, err = json.Marshal(&besapi)
 		if err != nil {
-fmt.Printf("DEBUG.BESAPI: for url [%s]\njson.Marshal failed, err [%s]\nRaw json [%s]\n------------\n\n", urlStr, err, jsonValue)
+			fmt.Printf("DEBUG.BESAPI: for url [%s]\njson.Marshal failed, err [%s]\nRaw json [%s]\n------------\n\n", urlStr, err, jsonValue)
 			sc.cpool.Release(conn)
-			return nil, err
+			return nil, false, false, err
 		}
 	} else {
 		err = xml.Unmarshal(([]byte)(rawResponse), &bes)
 		if err != nil {
-fmt.Printf("DEBUG.BES: for url [%s]\nxml.Unmarshal failed, err [%s]\nRaw result [%s]\n------------\n\n", urlStr, err, rawResponse)
+			fmt.Printf("DEBUG.BES: for url [%s]\nxml.Unmarshal failed, err [%s]\nRaw result [%s]\n------------\n\n", urlStr, err, rawResponse)
 			sc.cpool.Release(conn)
-			return nil, err
+			return nil, false, false, err
 		}
 
 		jsonValue, err = json.Marshal(&bes)
 		if err != nil {
-fmt.Printf("DEBUG.BES: for url [%s]\njson.Marshal failed, err [%s]\nRaw json [%s]\n------------\n\n", urlStr, err, jsonValue)
+			fmt.Printf("DEBUG.BES: for url [%s]\njson.Marshal failed, err [%s]\nRaw json [%s]\n------------\n\n", urlStr, err, jsonValue)
 			sc.cpool.Release(conn)
-			return nil, err
+			return nil, false, false, err
 		}
 	}
 
@@ -405,12 +996,15 @@ fmt.Printf("DEBUG.BES: for url [%s]\njson.Marshal failed, err [%s]\nRaw json [%s
 
 	sc.cpool.Release(conn)
 	return &CacheItem{
-		Timestamp:   time.Now().Unix(),
-		Json:        jStr,
-		MaxAge:      sc.MaxAge,
-		BaseMaxAge:  sc.MaxAge,
-		ContentHash: contentHash,
-	}, nil
+		Timestamp:       time.Now().Unix(),
+		Json:            jStr,
+		MaxAge:          maxAge,
+		BaseMaxAge:      maxAge,
+		ContentHash:     contentHash,
+		ETag:            resp.ETag,
+		LastModified:    resp.LastModified,
+		HasServerMaxAge: hasServerMaxAge,
+	}, false, oversized, nil
 }
 
 // PopulateCoreTypes populates the BigFixCache with core types by making API calls to the specified serverUrl.
@@ -513,26 +1107,34 @@ func (cache *BigFixCache) StartGarbageCollector(interval uint64) {
 // preserve other metadata for potential reuse.
 func (cache *BigFixCache) sweepExpiredItems() {
 	now := time.Now().Unix()
+	defer metrics.RecordGCSweep()
 
 	cache.ServerCache.Range(func(key, value interface{}) bool {
 		server := value.(*BigFixServerCache)
 
-		server.CacheMap.Range(func(urlKey, itemValue interface{}) bool {
-			item := itemValue.(*CacheItem)
-
+		server.CacheMap.Range(func(urlKey string, item *CacheItem) bool {
 			// Check if item is expired
 			if now-item.Timestamp > int64(item.MaxAge) {
 				// Create a new CacheItem with empty Json but preserve other fields
 				clearedItem := &CacheItem{
-					Timestamp:   item.Timestamp,
-					Json:        "", // Clear the JSON data to free memory
-					MaxAge:      item.MaxAge,
-					BaseMaxAge:  item.BaseMaxAge,
-					ContentHash: item.ContentHash,
+					Timestamp:       item.Timestamp,
+					Json:            "", // Clear the JSON data to free memory
+					MaxAge:          item.MaxAge,
+					BaseMaxAge:      item.BaseMaxAge,
+					ContentHash:     item.ContentHash,
+					HitCount:        item.HitCount,
+					MissCount:       item.MissCount,
+					ETag:            item.ETag,
+					LastModified:    item.LastModified,
+					HasServerMaxAge: item.HasServerMaxAge,
 				}
 
 				// Replace the entire CacheItem for thread safety
-				server.CacheMap.Store(urlKey, clearedItem)
+				server.CacheMap.Set(urlKey, clearedItem)
+				atomic.AddInt64(&server.hotBytes, -int64(len(item.Json)))
+				metrics.RecordExpired(server.ServerName)
+				metrics.SetBytes(server.ServerName, atomic.LoadInt64(&server.hotBytes))
+				cache.publishEvent(EventExpired, server.ServerName, urlKey, clearedItem)
 			}
 
 			return true
@@ -1,61 +1,262 @@
 package bfrest
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest/metrics"
 )
 
+// defaultAcquireTimeout bounds Acquire, the context-less convenience
+// wrapper around AcquireContext.
+const defaultAcquireTimeout = 30 * time.Second
+
+// TLSOptions configures how a Pool's connections verify the BigFix
+// server's certificate and, optionally, authenticate themselves to it.
+// The zero value uses the system root CAs and presents no client
+// certificate - i.e. ordinary one-way TLS.
+type TLSOptions struct {
+	CABundle   []byte // PEM-encoded CA certificates for verifying the server; nil uses system roots
+	ClientCert []byte // PEM-encoded client certificate, for mutual TLS
+	ClientKey  []byte // PEM-encoded client private key, for mutual TLS
+
+	// Insecure disables server certificate verification entirely. It
+	// exists for lab/self-signed deployments and logs a warning to
+	// stderr every time a connection is built with it set.
+	Insecure bool
+}
+
+// buildTLSConfig turns TLSOptions into a *tls.Config. A nil opts
+// produces the Go default (verify against system roots, no client cert),
+// matching historical behavior before Insecure was introduced.
+func buildTLSConfig(opts *TLSOptions) (*tls.Config, error) {
+	if opts == nil {
+		return &tls.Config{}, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: opts.Insecure}
+
+	if opts.Insecure {
+		fmt.Fprintln(os.Stderr, "WARNING: BigFix server TLS certificate verification is disabled (Insecure=true)")
+	}
+
+	if len(opts.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(opts.CABundle) {
+			return nil, fmt.Errorf("failed to parse CA bundle")
+		}
+		cfg.RootCAs = pool
+	}
+
+	if len(opts.ClientCert) > 0 || len(opts.ClientKey) > 0 {
+		cert, err := tls.X509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
 // BFConnection represents a connection configuration.
 type BFConnection struct {
 	URL      string
 	Username string
 	Password string
 	Conn     http.Client
-}
 
-// Get sends a GET request to the specified URL and returns the response body as a string.
+	// RetryPolicy controls GetContext's retry/backoff behavior. The zero
+	// value falls back to DefaultRetryPolicy.
+	RetryPolicy RetryPolicy
+
+	retryCount uint64 // atomic: total retry attempts made by this connection
+	pool       *Pool  // owning pool, for Stats() retry aggregation; nil if unpooled
+}
 
+// Get sends a GET request to the specified URL and returns the response
+// body as a string, retrying transient failures per RetryPolicy. It is
+// GetContext with context.Background().
 func (c *BFConnection) Get(urlStr string) (string, error) {
-	parsedURL, err := url.Parse(urlStr)
+	return c.GetContext(context.Background(), urlStr)
+}
+
+// GetContext behaves like Get but honors ctx for cancellation and
+// retries network errors, 429s, and 5xx responses with exponential
+// backoff. A Retry-After header, when the server sends one, replaces
+// the computed backoff for that wait; the wait is still jittered and
+// capped at MaxBackoff.
+func (c *BFConnection) GetContext(ctx context.Context, urlStr string) (string, error) {
+	resp, err := c.GetConditionalContext(ctx, urlStr, "", "")
 	if err != nil {
 		return "", err
 	}
+	return resp.Body, nil
+}
+
+// ConditionalResponse is the result of GetConditional/GetConditionalContext:
+// the response body (empty on a 304) plus the revalidation/caching headers
+// the BigFix REST API returned, for CacheItem to persist across requests.
+type ConditionalResponse struct {
+	StatusCode   int
+	Body         string
+	ETag         string
+	LastModified string
+	CacheControl string
+	Expires      string
+}
+
+// NotModified reports whether the server responded 304 Not Modified to
+// a conditional request, meaning the caller's cached body is still valid.
+func (r *ConditionalResponse) NotModified() bool {
+	return r.StatusCode == http.StatusNotModified
+}
+
+// GetConditional is GetConditionalContext with context.Background().
+func (c *BFConnection) GetConditional(urlStr, ifNoneMatch, ifModifiedSince string) (*ConditionalResponse, error) {
+	return c.GetConditionalContext(context.Background(), urlStr, ifNoneMatch, ifModifiedSince)
+}
+
+// GetConditionalContext sends a GET request, attaching If-None-Match
+// and/or If-Modified-Since when non-empty, and retries transient
+// failures per RetryPolicy exactly like GetContext. A 304 response is
+// not an error: the caller should treat it as "my cached copy is still
+// valid" rather than re-parsing an (empty) body.
+func (c *BFConnection) GetConditionalContext(ctx context.Context, urlStr, ifNoneMatch, ifModifiedSince string) (*ConditionalResponse, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, err
+	}
 
 	// Compare the non-directory components of the BFConnection URL and the parsed URL
 	if c.URL != parsedURL.Scheme+"://"+parsedURL.Host {
-		return "", fmt.Errorf("URL does not match")
+		return nil, fmt.Errorf("URL does not match")
 	}
 
-	req, err := http.NewRequest("GET", urlStr, nil)
+	policy := c.RetryPolicy.orDefault()
+	backoff := policy.InitialBackoff
+
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		resp, retryAfter, err := c.doGetConditional(ctx, urlStr, ifNoneMatch, ifModifiedSince)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		if attempt == policy.MaxAttempts || !isRetryableErr(err) {
+			break
+		}
+
+		atomic.AddUint64(&c.retryCount, 1)
+		if c.pool != nil {
+			atomic.AddUint64(&c.pool.retryCount, 1)
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		wait = jittered(wait, policy.Jitter)
+		if wait > policy.MaxBackoff {
+			wait = policy.MaxBackoff
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+
+	return nil, lastErr
+}
+
+// doGetConditional performs a single GET attempt, optionally as a
+// conditional request, returning the parsed Retry-After duration (0 if
+// absent) alongside the response/error. A 304 is returned as a
+// successful *ConditionalResponse, not an error: only 429/5xx count as
+// retryable failures (see isRetryableStatus).
+func (c *BFConnection) doGetConditional(ctx context.Context, urlStr, ifNoneMatch, ifModifiedSince string) (*ConditionalResponse, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
 
 	req.SetBasicAuth(c.Username, c.Password)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	if ifModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", ifModifiedSince)
+	}
 
+	start := time.Now()
 	resp, err := c.Conn.Do(req)
+	metrics.ObserveUpstreamLatency(c.URL, req.URL.Path, time.Since(start).Seconds())
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, 0, err
 	}
 
-	return string(body), nil
+	if isRetryableStatus(resp.StatusCode) {
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
+	return &ConditionalResponse{
+		StatusCode:   resp.StatusCode,
+		Body:         string(body),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		CacheControl: resp.Header.Get("Cache-Control"),
+		Expires:      resp.Header.Get("Expires"),
+	}, 0, nil
+}
+
+// parseRetryAfter parses a Retry-After header value expressed as a
+// number of seconds. HTTP-date values aren't used by BigFix and are
+// treated the same as "absent" (0).
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
 }
 
 // createBFConnection creates a new BFConnection instance.
-func createBFConnection(urlStr string, username string, password string) (*BFConnection, error) {
+func createBFConnection(urlStr string, username string, password string, tlsOpts *TLSOptions) (*BFConnection, error) {
+	tlsConfig, err := buildTLSConfig(tlsOpts)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize the http.Transport. You might want to customize this based on your requirements.
 	transport := http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: tlsConfig,
 	}
 
 	// Initialize the http.Client. You can also customize this as needed.
@@ -76,23 +277,41 @@ func createBFConnection(urlStr string, username string, password string) (*BFCon
 type Pool struct {
 	connections chan *BFConnection
 	factory     func() (*BFConnection, error)
-	closed      bool
+	closed      int32 // atomic
 	mutex       sync.Mutex
+
+	breaker         *circuitBreaker
+	retryCount      uint64 // atomic: connections' cumulative GetContext retries, snapshotted in Stats
+	acquireFailures uint64 // atomic
+
+	serverLabel string // base URL, used only to label Prometheus metrics
 }
 
-// NewPool creates a new pool of connections.
+// NewPool creates a new pool of connections that verify the server's
+// certificate against the system root CAs and present no client
+// certificate. Use NewPoolWithTLS to configure a custom CA bundle,
+// mutual TLS, or an explicit Insecure opt-out.
 func NewPool(urlStr, username, password string, size int) (*Pool, error) {
+	return NewPoolWithTLS(urlStr, username, password, size, nil)
+}
+
+// NewPoolWithTLS creates a new pool of connections using tlsOpts to
+// control server verification and optional mutual TLS. A nil tlsOpts
+// is equivalent to NewPool.
+func NewPoolWithTLS(urlStr, username, password string, size int, tlsOpts *TLSOptions) (*Pool, error) {
 	if size <= 0 {
 		return nil, fmt.Errorf("size value too small")
 	}
 
 	factory := func() (*BFConnection, error) {
-		return createBFConnection(urlStr, username, password)
+		return createBFConnection(urlStr, username, password, tlsOpts)
 	}
 
 	pool := &Pool{
 		connections: make(chan *BFConnection, size),
 		factory:     factory,
+		breaker:     defaultCircuitBreaker(),
+		serverLabel: getBaseUrl(urlStr),
 	}
 
 	for i := 0; i < size; i++ {
@@ -100,6 +319,7 @@ func NewPool(urlStr, username, password string, size int) (*Pool, error) {
 		if err != nil {
 			return nil, err
 		}
+		connection.pool = pool
 		pool.connections <- connection
 	}
 
@@ -111,24 +331,61 @@ func (p *Pool) Len() int {
 	return len(p.connections)
 }
 
-// Acquire retrieves a connection from the pool.
+// Acquire retrieves a connection from the pool, waiting up to
+// defaultAcquireTimeout. It is AcquireContext with that timeout applied.
 func (p *Pool) Acquire() (*BFConnection, error) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	fmt.Println("Acquire")
-	if p.closed {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAcquireTimeout)
+	defer cancel()
+	return p.AcquireContext(ctx)
+}
+
+// AcquireContext retrieves a connection from the pool, waiting until one
+// is available or ctx is done. It returns ErrCircuitOpen without
+// waiting if the pool's circuit breaker has tripped (see RecordFailure/
+// RecordSuccess, called by callers after using the returned connection).
+func (p *Pool) AcquireContext(ctx context.Context) (*BFConnection, error) {
+	if atomic.LoadInt32(&p.closed) != 0 {
 		return nil, fmt.Errorf("pool is closed")
 	}
 
-	return <-p.connections, nil
+	if !p.breaker.allow() {
+		atomic.AddUint64(&p.acquireFailures, 1)
+		return nil, ErrCircuitOpen
+	}
+
+	start := time.Now()
+	select {
+	case conn, ok := <-p.connections:
+		metrics.ObservePoolAcquireWait(p.serverLabel, time.Since(start).Seconds())
+		if !ok {
+			return nil, fmt.Errorf("pool is closed")
+		}
+		return conn, nil
+	case <-ctx.Done():
+		atomic.AddUint64(&p.acquireFailures, 1)
+		p.breaker.recordFailure()
+		return nil, ctx.Err()
+	}
+}
+
+// RecordSuccess reports a successful use of a connection acquired from
+// the pool, closing the circuit breaker if it was half-open.
+func (p *Pool) RecordSuccess() {
+	p.breaker.recordSuccess()
+}
+
+// RecordFailure reports a failed use of a connection acquired from the
+// pool (a network error or 5xx/429 from the server), counting toward
+// the circuit breaker's trip threshold.
+func (p *Pool) RecordFailure() {
+	p.breaker.recordFailure()
 }
 
 // Release returns a connection to the pool.
 func (p *Pool) Release(c *BFConnection) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	fmt.Println("Release")
-	if p.closed {
+	if atomic.LoadInt32(&p.closed) != 0 {
 		// handle closed pool scenario, maybe discard the connection
 		return
 	}
@@ -141,11 +398,10 @@ func (p *Pool) Close() {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
-	if p.closed {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
 		return
 	}
 
-	p.closed = true
 	close(p.connections)
 	for r := range p.connections {
 		// Close or cleanup the resource.
@@ -0,0 +1,153 @@
+package bfrest
+
+// This file implements the optional disk-backed tier that sits behind
+// the in-memory CacheMap. It is modeled on diskv-style block-transformed
+// directories: each cached URL is hashed and written under a couple of
+// levels of subdirectories so no single directory ends up with millions
+// of entries.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diskEnvelope is the on-disk representation of a spilled CacheItem,
+// including the original URL so the janitor can log/identify entries
+// without having to reverse the hash.
+type diskEnvelope struct {
+	URL  string     `json:"url"`
+	Item *CacheItem `json:"item"`
+}
+
+// diskPath returns the sharded on-disk path for a server+URL pair:
+// <diskDir>/<serverHash[:2]>/<urlHash[:2]>/<urlHash>.json
+func diskPath(diskDir, serverName, url string) string {
+	serverHash := sha256.Sum256([]byte(serverName))
+	urlHash := sha256.Sum256([]byte(url))
+	serverHex := hex.EncodeToString(serverHash[:])
+	urlHex := hex.EncodeToString(urlHash[:])
+
+	return filepath.Join(diskDir, serverHex[:2], urlHex[:2], urlHex+".json")
+}
+
+// spillToDisk persists an evicted CacheItem to the disk tier. Errors are
+// swallowed (best-effort) since the hot-tier eviction that triggered
+// this must not be blocked or failed by a disk hiccup.
+func spillToDisk(diskDir, serverName, url string, item *CacheItem) {
+	if diskDir == "" {
+		return
+	}
+
+	path := diskPath(diskDir, serverName, url)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(diskEnvelope{URL: url, Item: item})
+	if err != nil {
+		return
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
+
+// loadFromDisk reads back a previously-spilled CacheItem, returning
+// (nil, false) if it doesn't exist, is unreadable, or has exceeded
+// maxCacheLifetime since it was written.
+func loadFromDisk(diskDir, serverName, url string, maxCacheLifetime uint64) (*CacheItem, bool) {
+	if diskDir == "" {
+		return nil, false
+	}
+
+	path := diskPath(diskDir, serverName, url)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var envelope diskEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Item == nil {
+		return nil, false
+	}
+
+	if maxCacheLifetime > 0 {
+		age := time.Now().Unix() - envelope.Item.Timestamp
+		if age > int64(maxCacheLifetime) {
+			os.Remove(path)
+			return nil, false
+		}
+	}
+
+	return envelope.Item, true
+}
+
+// removeFromDisk deletes a spilled entry, e.g. after it's promoted back
+// into the hot tier or purged.
+func removeFromDisk(diskDir, serverName, url string) {
+	if diskDir == "" {
+		return
+	}
+	os.Remove(diskPath(diskDir, serverName, url))
+}
+
+// StartDiskJanitor starts a background goroutine that periodically walks
+// DiskDir and removes files older than MaxCacheLifetime. It is a no-op
+// if DiskDir is not configured. interval is in seconds (default 300).
+func (cache *BigFixCache) StartDiskJanitor(interval uint64) {
+	if cache.DiskDir == "" {
+		return
+	}
+	if interval == 0 {
+		interval = 300
+	}
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+
+	go func() {
+		for range ticker.C {
+			cache.sweepDiskTier()
+		}
+	}()
+}
+
+func (cache *BigFixCache) sweepDiskTier() {
+	if cache.DiskDir == "" {
+		return
+	}
+
+	now := time.Now().Unix()
+
+	filepath.Walk(cache.DiskDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info == nil || info.IsDir() {
+			return nil
+		}
+		if filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		var envelope diskEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil || envelope.Item == nil {
+			os.Remove(path)
+			return nil
+		}
+
+		if cache.MaxCacheLifetime > 0 && now-envelope.Item.Timestamp > int64(cache.MaxCacheLifetime) {
+			os.Remove(path)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,203 @@
+package bfrest
+
+// This file implements retry/backoff semantics for BFConnection.GetContext
+// and a per-pool circuit breaker for Pool.AcquireContext, so a flaky or
+// overloaded BigFix server degrades gracefully instead of hanging every
+// caller forever.
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy parameterizes the exponential backoff retry loop used by
+// BFConnection.GetContext. MaxAttempts includes the initial try, so
+// MaxAttempts=1 disables retrying.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64 // fraction (0..1) of the backoff to randomize
+}
+
+// DefaultRetryPolicy is used by GetContext/Get when a BFConnection's
+// RetryPolicy is left at its zero value.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Jitter:         0.2,
+}
+
+func (p RetryPolicy) orDefault() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		return DefaultRetryPolicy
+	}
+	return p
+}
+
+// jittered returns d adjusted by +/- jitter*d, picked uniformly at random.
+func jittered(d time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+	delta := float64(d) * jitter
+	return d + time.Duration((rand.Float64()*2-1)*delta)
+}
+
+// httpStatusError marks a response whose status code, not a transport
+// error, is what makes the request a failure. Only 429 and 5xx are
+// considered retryable.
+type httpStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return http.StatusText(e.StatusCode)
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// isRetryableErr reports whether err represents a transient failure
+// worth retrying: any transport-level error, or an httpStatusError
+// carrying a retryable status code.
+func isRetryableErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.StatusCode)
+	}
+	return true
+}
+
+// ErrCircuitOpen is returned by Pool.Acquire/AcquireContext while the
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("bfrest: circuit breaker open, server is unhealthy")
+
+// circuitBreaker trips after FailureThreshold consecutive failures
+// observed within Window, then refuses new attempts for Cooldown before
+// allowing a single half-open probe through.
+type circuitBreaker struct {
+	FailureThreshold int
+	Window           time.Duration
+	Cooldown         time.Duration
+
+	mu               sync.Mutex
+	consecutiveFails int
+	firstFailureAt   time.Time
+	open             bool
+	openedAt         time.Time
+	probeInFlight    bool
+}
+
+// defaultCircuitBreaker returns a breaker with reasonable defaults: trip
+// after 5 consecutive failures inside a 30s window, cool down for 15s.
+func defaultCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		FailureThreshold: 5,
+		Window:           30 * time.Second,
+		Cooldown:         15 * time.Second,
+	}
+}
+
+// allow reports whether a new attempt may proceed. It returns false
+// while the breaker is open, except for a single half-open probe once
+// the cooldown has elapsed.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+
+	if time.Since(b.openedAt) < b.Cooldown {
+		return false
+	}
+
+	if b.probeInFlight {
+		return false
+	}
+
+	b.probeInFlight = true
+	return true
+}
+
+// recordSuccess closes the breaker (if it was half-open) and resets the
+// failure streak.
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFails = 0
+	b.open = false
+	b.probeInFlight = false
+}
+
+// recordFailure counts a failure toward FailureThreshold within Window,
+// tripping the breaker if it's reached. A failed half-open probe
+// re-opens the breaker immediately.
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.probeInFlight {
+		b.probeInFlight = false
+		b.open = true
+		b.openedAt = time.Now()
+		b.consecutiveFails = 0
+		return
+	}
+
+	now := time.Now()
+	if b.consecutiveFails == 0 || now.Sub(b.firstFailureAt) > b.Window {
+		b.firstFailureAt = now
+		b.consecutiveFails = 1
+	} else {
+		b.consecutiveFails++
+	}
+
+	if b.consecutiveFails >= b.FailureThreshold {
+		b.open = true
+		b.openedAt = now
+	}
+}
+
+// state reports the breaker's status and current consecutive-failure
+// count for Stats().
+func (b *circuitBreaker) state() (open bool, consecutiveFails int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open, b.consecutiveFails
+}
+
+// PoolStats summarizes a Pool's health, as returned by Stats().
+type PoolStats struct {
+	Available           int
+	CircuitOpen         bool
+	ConsecutiveFailures int
+	RetryCount          uint64
+	AcquireFailures     uint64
+}
+
+// Stats reports the pool's current connection availability, circuit
+// breaker state, and cumulative retry/failure counters.
+func (p *Pool) Stats() PoolStats {
+	open, fails := p.breaker.state()
+	return PoolStats{
+		Available:           p.Len(),
+		CircuitOpen:         open,
+		ConsecutiveFailures: fails,
+		RetryCount:          atomic.LoadUint64(&p.retryCount),
+		AcquireFailures:     atomic.LoadUint64(&p.acquireFailures),
+	}
+}
@@ -0,0 +1,129 @@
+package bfrest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTripsAfterThreshold(t *testing.T) {
+	cases := []struct {
+		name      string
+		threshold int
+		failures  int
+		wantOpen  bool
+	}{
+		{name: "below threshold stays closed", threshold: 3, failures: 2, wantOpen: false},
+		{name: "reaching threshold trips open", threshold: 3, failures: 3, wantOpen: true},
+		{name: "exceeding threshold stays open", threshold: 3, failures: 5, wantOpen: true},
+		{name: "single-failure threshold trips immediately", threshold: 1, failures: 1, wantOpen: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &circuitBreaker{FailureThreshold: tc.threshold, Window: time.Minute, Cooldown: time.Minute}
+			for i := 0; i < tc.failures; i++ {
+				b.recordFailure()
+			}
+			open, fails := b.state()
+			if open != tc.wantOpen {
+				t.Errorf("after %d failures (threshold %d): open = %v, want %v", tc.failures, tc.threshold, open, tc.wantOpen)
+			}
+			if !tc.wantOpen && fails != tc.failures {
+				t.Errorf("expected consecutiveFails %d, got %d", tc.failures, fails)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerAllowReflectsState(t *testing.T) {
+	b := defaultCircuitBreaker()
+
+	if !b.allow() {
+		t.Fatal("a fresh breaker should allow attempts")
+	}
+
+	for i := 0; i < b.FailureThreshold; i++ {
+		b.recordFailure()
+	}
+	if open, _ := b.state(); !open {
+		t.Fatal("breaker should be open after reaching FailureThreshold")
+	}
+	if b.allow() {
+		t.Error("allow should refuse attempts while open and within Cooldown")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeSucceeds(t *testing.T) {
+	b := &circuitBreaker{FailureThreshold: 1, Window: time.Minute, Cooldown: time.Millisecond}
+	b.recordFailure()
+	if open, _ := b.state(); !open {
+		t.Fatal("breaker should be open after one failure at threshold 1")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("allow should let a single half-open probe through once Cooldown has elapsed")
+	}
+	if b.allow() {
+		t.Error("allow should refuse a second concurrent half-open probe")
+	}
+
+	b.recordSuccess()
+	if open, fails := b.state(); open || fails != 0 {
+		t.Errorf("a successful probe should close the breaker and reset the failure streak, got open=%v fails=%d", open, fails)
+	}
+	if !b.allow() {
+		t.Error("breaker should allow attempts again after a successful probe")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeFailureReopens(t *testing.T) {
+	b := &circuitBreaker{FailureThreshold: 1, Window: time.Minute, Cooldown: time.Millisecond}
+	b.recordFailure()
+	time.Sleep(2 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected the half-open probe to be allowed through")
+	}
+
+	b.recordFailure()
+	if open, _ := b.state(); !open {
+		t.Error("a failed half-open probe should re-open the breaker")
+	}
+	if b.allow() {
+		t.Error("allow should refuse attempts immediately after a failed probe re-opens the breaker")
+	}
+}
+
+func TestCircuitBreakerFailuresOutsideWindowDontAccumulate(t *testing.T) {
+	b := &circuitBreaker{FailureThreshold: 2, Window: time.Millisecond, Cooldown: time.Minute}
+
+	b.recordFailure()
+	time.Sleep(2 * time.Millisecond)
+	b.recordFailure()
+
+	open, fails := b.state()
+	if open {
+		t.Error("failures separated by more than Window should not accumulate toward the trip threshold")
+	}
+	if fails != 1 {
+		t.Errorf("expected the stale failure to be discarded and the streak reset to 1, got %d", fails)
+	}
+}
+
+func TestCircuitBreakerSuccessResetsStreak(t *testing.T) {
+	b := &circuitBreaker{FailureThreshold: 3, Window: time.Minute, Cooldown: time.Minute}
+	b.recordFailure()
+	b.recordFailure()
+	b.recordSuccess()
+	b.recordFailure()
+
+	open, fails := b.state()
+	if open {
+		t.Error("a success should reset the failure streak, so one subsequent failure shouldn't trip the breaker")
+	}
+	if fails != 1 {
+		t.Errorf("expected consecutiveFails 1 after a reset, got %d", fails)
+	}
+}
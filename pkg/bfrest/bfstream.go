@@ -0,0 +1,122 @@
+package bfrest
+
+// This file adds a streaming companion to BFConnection.Get: rather than
+// buffering the full BigFix XML response into memory and unmarshaling
+// it in one shot, Stream tokenizes it incrementally and emits one Row
+// per top-level child of the response's root element as soon as its
+// closing tag is seen.
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Row is a single top-level child element of a streamed BigFix XML
+// response (e.g. one <Computer> of a BESAPI computer list).
+type Row struct {
+	Name  string            `json:"name"`
+	Attrs map[string]string `json:"attrs,omitempty"`
+	XML   string            `json:"xml"`
+}
+
+// xmlNode captures an arbitrary element's attributes and raw inner XML
+// without requiring a schema-specific struct, since Stream doesn't know
+// in advance whether it's reading BES or BESAPI content.
+type xmlNode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content []byte     `xml:",innerxml"`
+}
+
+// Stream sends a GET request to urlStr and streams each top-level child
+// of the response's root element as a Row, closing the rows channel
+// when the response is exhausted and the errs channel after reporting
+// at most one error. Canceling ctx stops the stream and is reported on
+// errs as ctx.Err().
+func (c *BFConnection) Stream(ctx context.Context, urlStr string) (<-chan Row, <-chan error) {
+	rows := make(chan Row)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(rows)
+		defer close(errs)
+
+		req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+		if err != nil {
+			errs <- err
+			return
+		}
+		req.SetBasicAuth(c.Username, c.Password)
+
+		resp, err := c.Conn.Do(req)
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer resp.Body.Close()
+
+		if isRetryableStatus(resp.StatusCode) || resp.StatusCode >= 400 {
+			errs <- fmt.Errorf("unexpected status code %d streaming %s", resp.StatusCode, urlStr)
+			return
+		}
+
+		decoder := xml.NewDecoder(resp.Body)
+		rootSeen := false
+
+		for {
+			tok, err := decoder.Token()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			start, ok := tok.(xml.StartElement)
+			if !ok {
+				continue
+			}
+
+			if !rootSeen {
+				rootSeen = true
+				continue
+			}
+
+			var node xmlNode
+			if err := decoder.DecodeElement(&node, &start); err != nil {
+				errs <- err
+				return
+			}
+
+			row := Row{
+				Name:  node.XMLName.Local,
+				Attrs: attrsToMap(node.Attrs),
+				XML:   string(node.Content),
+			}
+
+			select {
+			case rows <- row:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return rows, errs
+}
+
+func attrsToMap(attrs []xml.Attr) map[string]string {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		m[a.Name.Local] = a.Value
+	}
+	return m
+}
@@ -0,0 +1,82 @@
+package bfrest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverMaxAge resolves the authoritative TTL (in seconds) a BigFix
+// response asked for, preferring Cache-Control's s-maxage, then max-age,
+// then Expires. The bool return is false when the response carried none
+// of these, meaning the caller should fall back to its own configured
+// default instead.
+func serverMaxAge(cacheControl, expires string) (uint64, bool) {
+	if maxAge, ok := parseCacheControlMaxAge(cacheControl); ok {
+		return maxAge, true
+	}
+	if maxAge, ok := parseExpires(expires); ok {
+		return maxAge, true
+	}
+	return 0, false
+}
+
+// parseCacheControlMaxAge extracts s-maxage or max-age (in that order of
+// preference, matching HTTP's shared-cache precedence) from a
+// Cache-Control header value.
+func parseCacheControlMaxAge(header string) (uint64, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	directives := strings.Split(header, ",")
+	var maxAge *uint64
+	for _, directive := range directives {
+		directive = strings.TrimSpace(directive)
+		name, value, hasValue := strings.Cut(directive, "=")
+		if !hasValue {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		seconds, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch name {
+		case "s-maxage":
+			// s-maxage takes precedence over max-age for shared caches.
+			return seconds, true
+		case "max-age":
+			maxAge = &seconds
+		}
+	}
+
+	if maxAge != nil {
+		return *maxAge, true
+	}
+	return 0, false
+}
+
+// parseExpires converts an Expires header into a TTL relative to now. A
+// value in the past (already expired) yields a TTL of 0 rather than
+// being treated as absent.
+func parseExpires(header string) (uint64, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	expiresAt, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+
+	ttl := time.Until(expiresAt)
+	if ttl < 0 {
+		return 0, true
+	}
+	return uint64(ttl.Seconds()), true
+}
@@ -0,0 +1,150 @@
+package bfrest
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType identifies why a CacheEvent was published.
+type EventType string
+
+const (
+	// EventCreated fires the first time a URL is fetched and stored.
+	EventCreated EventType = "created"
+	// EventRefreshed fires when a refresh fetched changed content.
+	EventRefreshed EventType = "refreshed"
+	// EventUnchanged fires when a refresh confirmed the content hasn't
+	// changed (a 304, or a matching content hash).
+	EventUnchanged EventType = "unchanged"
+	// EventExpired fires when an item's Json is cleared by the garbage
+	// collector, or when it is evicted from the hot tier under LRU
+	// pressure.
+	EventExpired EventType = "expired"
+)
+
+// CacheEvent describes a single mutation of a CacheItem, published by
+// BigFixCache to anything subscribed via Subscribe.
+type CacheEvent struct {
+	Type        EventType
+	URL         string
+	ServerName  string
+	ContentHash string
+	Timestamp   int64
+	TTL         uint64
+	HitCount    uint64
+	MissCount   uint64
+}
+
+// EventFilter narrows a Subscribe call to a subset of events. A zero
+// EventFilter matches everything. Both fields are ANDed when set.
+type EventFilter struct {
+	// ServerPrefix, if non-empty, requires the event's ServerName (the
+	// server's base URL) to start with this prefix.
+	ServerPrefix string
+
+	// URLGlob, if non-empty, requires the event's URL to match this
+	// shell-style glob (see path.Match).
+	URLGlob string
+}
+
+func (f EventFilter) matches(ev CacheEvent) bool {
+	if f.ServerPrefix != "" && !strings.HasPrefix(ev.ServerName, f.ServerPrefix) {
+		return false
+	}
+	if f.URLGlob != "" {
+		if ok, err := path.Match(f.URLGlob, ev.URL); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// eventSubBufSize is the per-subscriber channel buffer. A slow
+// subscriber drops events past this point rather than stalling cache
+// operations - see eventBus.publish.
+const eventSubBufSize = 256
+
+type eventSub struct {
+	filter EventFilter
+	ch     chan CacheEvent
+}
+
+// eventBus is a small in-process pub/sub fan-out for CacheEvents. Its
+// zero value is ready to use, so it can be embedded in BigFixCache
+// without touching every construction site (including tests that build
+// a BigFixCache literal directly instead of going through GetCache).
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[int]*eventSub
+	next int
+}
+
+func (b *eventBus) subscribe(filter EventFilter) (<-chan CacheEvent, func()) {
+	ch := make(chan CacheEvent, eventSubBufSize)
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[int]*eventSub)
+	}
+	id := b.next
+	b.next++
+	b.subs[id] = &eventSub{filter: filter, ch: ch}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		if _, ok := b.subs[id]; ok {
+			delete(b.subs, id)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+
+	return ch, cancel
+}
+
+func (b *eventBus) publish(ev CacheEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subs {
+		if !sub.filter.matches(ev) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			// Subscriber isn't draining fast enough; drop rather than
+			// block the cache operation that triggered this event.
+		}
+	}
+}
+
+// Subscribe registers for cache change notifications matching filter
+// and returns a channel of events plus a cancel function. The caller
+// must call cancel when done to release the subscription; cancel closes
+// the returned channel.
+func (cache *BigFixCache) Subscribe(filter EventFilter) (<-chan CacheEvent, func()) {
+	return cache.events.subscribe(filter)
+}
+
+// publishEvent fills in the event's TTL/HitCount/MissCount from item (if
+// non-nil) and publishes it to every matching subscriber.
+func (cache *BigFixCache) publishEvent(evType EventType, serverName, url string, item *CacheItem) {
+	ev := CacheEvent{
+		Type:       evType,
+		URL:        url,
+		ServerName: serverName,
+		Timestamp:  time.Now().Unix(),
+	}
+	if item != nil {
+		ev.ContentHash = item.ContentHash
+		ev.TTL = item.MaxAge
+		ev.HitCount = item.HitCount
+		ev.MissCount = item.MissCount
+		ev.Timestamp = item.Timestamp
+	}
+	cache.events.publish(ev)
+}
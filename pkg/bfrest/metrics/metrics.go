@@ -0,0 +1,181 @@
+// Package metrics exposes Prometheus instrumentation for the bfrest cache
+// subsystem. bfrest records events through the package-level functions
+// below; the host application is responsible for exposing them, typically
+// by mounting promhttp.Handler() on its own mux (see cmd/bem's /metrics
+// route).
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// CacheHits counts Get calls served from the hot tier without needing
+	// a refresh, per server.
+	CacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "hits_total",
+		Help:      "Cache lookups served without contacting the BigFix server.",
+	}, []string{"server"})
+
+	// CacheMisses counts Get calls for a URL with no prior cache entry,
+	// per server.
+	CacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "misses_total",
+		Help:      "Cache lookups for a URL with no existing entry.",
+	}, []string{"server"})
+
+	// CacheRefreshes counts Get calls that found an expired or cleared
+	// entry and went back to the server, broken down by outcome:
+	// "not_modified" (304), "hash_match" (body refetched but unchanged),
+	// "hash_changed" (body refetched and different),
+	// "stale_while_revalidate" (stale item served while a background
+	// refresh runs), or "stale_if_error" (stale item served because the
+	// refresh failed).
+	CacheRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "refreshes_total",
+		Help:      "Cache refreshes against the BigFix server, by outcome.",
+	}, []string{"server", "result"})
+
+	// GCSweeps counts completed runs of the cache's background GC sweep.
+	GCSweeps = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "gc_sweeps_total",
+		Help:      "Completed background garbage-collection sweeps.",
+	})
+
+	// Evictions counts entries pushed out of a server's hot tier by LRU
+	// pressure (HotEntries/HotBytes), not by expiry.
+	Evictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "evictions_total",
+		Help:      "Entries evicted from the hot tier by LRU pressure.",
+	}, []string{"server"})
+
+	// Expired counts entries cleared by the background GC sweep because
+	// they passed MaxAge, not by LRU pressure.
+	Expired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "expired_total",
+		Help:      "Entries cleared by the background GC sweep for exceeding MaxAge.",
+	}, []string{"server"})
+
+	// Items reports the current number of hot-tier entries per server.
+	// Set in-place from sc.lru.len() (O(1)) wherever storeHot/evictHot
+	// already touch the LRU, rather than recomputed by walking CacheMap.
+	Items = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "items",
+		Help:      "Current number of entries in the hot tier, per server.",
+	}, []string{"server"})
+
+	// Bytes reports the current hot-tier footprint per server. Set
+	// in-place from sc.hotBytes (already maintained atomically) wherever
+	// storeHot/evictHot already adjust it.
+	Bytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "bytes",
+		Help:      "Current hot-tier footprint, in bytes, per server.",
+	}, []string{"server"})
+
+	// PayloadBytes observes the size of raw response bodies retrieved
+	// from the BigFix server, per server.
+	PayloadBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "payload_bytes",
+		Help:      "Size, in bytes, of raw response bodies fetched from the BigFix server.",
+		Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+	}, []string{"server"})
+
+	// UpstreamLatency observes round-trip time for a single GET/conditional
+	// GET to the BigFix server, per server and endpoint path.
+	UpstreamLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "bfrest",
+		Subsystem: "cache",
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of requests to the BigFix server, per endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server", "endpoint"})
+
+	// PoolAcquireWait observes how long callers waited for Pool.Acquire/
+	// AcquireContext to hand back a connection.
+	PoolAcquireWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "bfrest",
+		Subsystem: "pool",
+		Name:      "acquire_wait_seconds",
+		Help:      "Time spent waiting for a pooled BigFix connection.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"server"})
+)
+
+// RecordHit records a cache hit for server.
+func RecordHit(server string) {
+	CacheHits.WithLabelValues(server).Inc()
+}
+
+// RecordMiss records a cache miss for server.
+func RecordMiss(server string) {
+	CacheMisses.WithLabelValues(server).Inc()
+}
+
+// RecordRefresh records a cache refresh for server with the given
+// outcome ("not_modified", "hash_match", "hash_changed",
+// "stale_while_revalidate", or "stale_if_error").
+func RecordRefresh(server, result string) {
+	CacheRefreshes.WithLabelValues(server, result).Inc()
+}
+
+// RecordGCSweep records one completed background GC sweep.
+func RecordGCSweep() {
+	GCSweeps.Inc()
+}
+
+// RecordEviction records one hot-tier eviction for server.
+func RecordEviction(server string) {
+	Evictions.WithLabelValues(server).Inc()
+}
+
+// RecordExpired records one item cleared by the GC sweep for server.
+func RecordExpired(server string) {
+	Expired.WithLabelValues(server).Inc()
+}
+
+// SetItems updates the current hot-tier entry count for server.
+func SetItems(server string, n int) {
+	Items.WithLabelValues(server).Set(float64(n))
+}
+
+// SetBytes updates the current hot-tier byte footprint for server.
+func SetBytes(server string, n int64) {
+	Bytes.WithLabelValues(server).Set(float64(n))
+}
+
+// ObservePayloadBytes records the size of a raw response body fetched
+// from server.
+func ObservePayloadBytes(server string, bytes int) {
+	PayloadBytes.WithLabelValues(server).Observe(float64(bytes))
+}
+
+// ObserveUpstreamLatency records how long a request to endpoint on
+// server took.
+func ObserveUpstreamLatency(server, endpoint string, seconds float64) {
+	UpstreamLatency.WithLabelValues(server, endpoint).Observe(seconds)
+}
+
+// ObservePoolAcquireWait records how long a caller waited to acquire a
+// connection from server's pool.
+func ObservePoolAcquireWait(server string, seconds float64) {
+	PoolAcquireWait.WithLabelValues(server).Observe(seconds)
+}
@@ -0,0 +1,111 @@
+package bfrest
+
+// This file implements a segmented LRU (SLRU) used to order each
+// BigFixServerCache's hot tier for eviction. It replaces a plain
+// single-queue LRU with two queues - probation and protected - so a
+// single burst of one-off URLs (a hostile or pathological query
+// pattern) can't flush out entries that are genuinely being reused.
+
+import (
+	"container/list"
+	"sync"
+)
+
+// slruEntry tracks where a key currently lives: which list element
+// represents it, and in which of the two queues.
+type slruEntry struct {
+	elem      *list.Element
+	protected bool
+}
+
+// lruTracker is a segmented LRU: every key starts in probation on its
+// first touch and is promoted to protected on its second. Eviction (via
+// oldest) always drains probation before touching protected, so
+// frequently-reused entries survive a flood of cold, one-off fetches.
+// All operations are O(1).
+type lruTracker struct {
+	mu    sync.Mutex
+	index map[string]*slruEntry
+
+	probation *list.List
+	protected *list.List
+}
+
+func newLRUTracker() *lruTracker {
+	return &lruTracker{
+		index:     make(map[string]*slruEntry),
+		probation: list.New(),
+		protected: list.New(),
+	}
+}
+
+// touch marks key as most-recently-used. A key seen for the first time
+// is added to probation; a key already in probation is promoted to
+// protected; a key already in protected just moves to its front.
+func (l *lruTracker) touch(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.index[key]
+	if !ok {
+		l.index[key] = &slruEntry{elem: l.probation.PushFront(key), protected: false}
+		return
+	}
+
+	if entry.protected {
+		l.protected.MoveToFront(entry.elem)
+		return
+	}
+
+	l.probation.Remove(entry.elem)
+	entry.elem = l.protected.PushFront(key)
+	entry.protected = true
+}
+
+// remove stops tracking key (called once it's evicted or deleted).
+func (l *lruTracker) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.index[key]
+	if !ok {
+		return
+	}
+	if entry.protected {
+		l.protected.Remove(entry.elem)
+	} else {
+		l.probation.Remove(entry.elem)
+	}
+	delete(l.index, key)
+}
+
+// oldest returns the least-recently-used key, preferring probation's
+// tail over protected's so frequently-reused entries are evicted last.
+func (l *lruTracker) oldest() (string, bool) {
+	key, _, ok := l.oldestWithQueue()
+	return key, ok
+}
+
+// oldestWithQueue is like oldest but also reports whether the returned
+// key came from the protected queue, so a caller comparing candidates
+// across multiple lruTrackers (see BigFixCache.oldestAcrossServers) can
+// honor "probation before protected" globally, not just within this one
+// tracker's own queues.
+func (l *lruTracker) oldestWithQueue() (key string, protected bool, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if back := l.probation.Back(); back != nil {
+		return back.Value.(string), false, true
+	}
+	if back := l.protected.Back(); back != nil {
+		return back.Value.(string), true, true
+	}
+	return "", false, false
+}
+
+func (l *lruTracker) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.probation.Len() + l.protected.Len()
+}
@@ -0,0 +1,103 @@
+package bfrest_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest"
+	"github.com/tubalcaine/bigfix-mobile-enterprise/pkg/bfrest/testtls"
+)
+
+// newMTLSServer starts an httptest server that requires a client
+// certificate signed by env's CA, mirroring how a BigFix server
+// configured for mutual TLS (see cmd/bem/server.go's ClientCAs handling)
+// would behave.
+func newMTLSServer(t *testing.T, env *testtls.Env) *httptest.Server {
+	t.Helper()
+
+	serverCert, err := tls.X509KeyPair(env.ServerCert, env.ServerKey)
+	if err != nil {
+		t.Fatalf("loading server cert: %v", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(env.CACert) {
+		t.Fatal("parsing CA cert into pool")
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	return srv
+}
+
+func TestPoolMutualTLSWithClientCert(t *testing.T) {
+	env, err := testtls.New([]string{"127.0.0.1"}, "test-client")
+	if err != nil {
+		t.Fatalf("generating test TLS material: %v", err)
+	}
+
+	srv := newMTLSServer(t, env)
+	defer srv.Close()
+
+	pool, err := bfrest.NewPoolWithTLS(srv.URL, "user", "pass", 1, &bfrest.TLSOptions{
+		CABundle:   env.CACert,
+		ClientCert: env.ClientCert,
+		ClientKey:  env.ClientKey,
+	})
+	if err != nil {
+		t.Fatalf("NewPoolWithTLS: %v", err)
+	}
+	defer pool.Close()
+
+	conn, err := pool.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer pool.Release(conn)
+
+	body, err := conn.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get with client cert should succeed against a server requiring one: %v", err)
+	}
+	if body != "ok" {
+		t.Errorf("expected body %q, got %q", "ok", body)
+	}
+}
+
+func TestPoolMutualTLSWithoutClientCertFails(t *testing.T) {
+	env, err := testtls.New([]string{"127.0.0.1"}, "test-client")
+	if err != nil {
+		t.Fatalf("generating test TLS material: %v", err)
+	}
+
+	srv := newMTLSServer(t, env)
+	defer srv.Close()
+
+	pool, err := bfrest.NewPoolWithTLS(srv.URL, "user", "pass", 1, &bfrest.TLSOptions{
+		CABundle: env.CACert,
+	})
+	if err != nil {
+		t.Fatalf("NewPoolWithTLS: %v", err)
+	}
+	defer pool.Close()
+
+	conn, err := pool.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer pool.Release(conn)
+
+	if _, err := conn.Get(srv.URL); err == nil {
+		t.Error("expected Get without a client cert to fail against a server requiring one, got nil error")
+	}
+}
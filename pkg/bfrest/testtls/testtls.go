@@ -0,0 +1,142 @@
+// Package testtls mints an in-memory CA, server certificate, and client
+// certificate so tests can exercise the full mTLS path (Pool, the gin
+// server's client-cert verification) without touching the filesystem or
+// a real CA. It is deliberately minimal - loopback-only certs with a
+// short validity window, modeled on the kind of throwaway test harness
+// git-lfs's test server uses.
+package testtls
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+)
+
+// Env bundles the PEM-encoded material produced by New: a CA cert, a
+// server cert/key signed by it for the given hosts, and a client
+// cert/key also signed by it for mutual TLS.
+type Env struct {
+	CACert []byte
+
+	ServerCert []byte
+	ServerKey  []byte
+
+	ClientCert []byte
+	ClientKey  []byte
+}
+
+// New generates a fresh CA plus a server certificate valid for hosts
+// (typically "localhost", "127.0.0.1") and a client certificate whose
+// Common Name is clientCN.
+func New(hosts []string, clientCN string) (*Env, error) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("generating CA key: %w", err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bem-testtls CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("creating CA cert: %w", err)
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA cert: %w", err)
+	}
+
+	serverCert, serverKey, err := signLeaf(caCert, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "bem-testtls server"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     dnsNames(hosts),
+		IPAddresses:  ipAddresses(hosts),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating server cert: %w", err)
+	}
+
+	clientCert, clientKey, err := signLeaf(caCert, caKey, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: clientCN},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating client cert: %w", err)
+	}
+
+	return &Env{
+		CACert:     encodeCert(caDER),
+		ServerCert: serverCert,
+		ServerKey:  serverKey,
+		ClientCert: clientCert,
+		ClientKey:  clientKey,
+	}, nil
+}
+
+// signLeaf issues template as a leaf certificate signed by caCert/caKey,
+// returning the PEM-encoded cert and key.
+func signLeaf(caCert *x509.Certificate, caKey *rsa.PrivateKey, template *x509.Certificate) (certPEM, keyPEM []byte, err error) {
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodeCert(der), encodeKey(leafKey), nil
+}
+
+func encodeCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func encodeKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// dnsNames returns the entries of hosts that don't parse as IP addresses.
+func dnsNames(hosts []string) []string {
+	var names []string
+	for _, h := range hosts {
+		if net.ParseIP(h) == nil {
+			names = append(names, h)
+		}
+	}
+	return names
+}
+
+// ipAddresses returns the entries of hosts that parse as IP addresses.
+func ipAddresses(hosts []string) []net.IP {
+	var ips []net.IP
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}